@@ -0,0 +1,172 @@
+package iris_extend_helper
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/kataras/iris/v12"
+	"github.com/pelletier/go-toml"
+)
+
+const DefaultClaimsKey = "jwt-claims"
+
+var (
+	ErrTokenMissing     = errors.New("token is missing")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	ErrTokenIssuedAt    = errors.New("token used before issued")
+	ErrTokenIssuer      = errors.New("token issuer is not accepted")
+	ErrTokenAudience    = errors.New("token audience is not accepted")
+)
+
+// JWTAuthentication and JWTAuthenticationWithRevocation fail when no key
+// set is given and the config has no usable verifying key, so that a
+// missing secret is caught at startup.
+func JWTAuthentication(config *toml.Tree, keys ...KeyLookup) (iris.Handler, error) {
+	return JWTAuthenticationWithRevocation(config, nil, keys...)
+}
+
+func JWTAuthenticationWithRevocation(config *toml.Tree, store RevocationStore, keys ...KeyLookup) (iris.Handler, error) {
+	contextKey := GetString(config, "context-key", DefaultClaimsKey)
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	var keyfunc jwt.Keyfunc
+	if len(keys) > 0 {
+		if config.Has("hash") {
+			method, err := GetSigningMethod(config)
+			if err != nil {
+				return nil, err
+			}
+			parser.ValidMethods = []string{method.Alg()}
+		}
+		keyfunc = keySetKeyfunc(keys[0])
+	} else {
+		methods, verifyingKey, err := tokenVerifier("", config)
+		if err != nil {
+			return nil, err
+		}
+		parser.ValidMethods = methods
+		keyfunc = func(token *jwt.Token) (interface{}, error) {
+			return verifyingKey, nil
+		}
+	}
+	return func(ctx iris.Context) {
+		str := ExtractToken(ctx.Request(), config)
+		if str == "" {
+			respondUnauthorized(ctx, ErrTokenMissing)
+			return
+		}
+		token, err := parser.Parse(str, keyfunc)
+		if err != nil {
+			respondUnauthorized(ctx, err)
+			return
+		}
+		claims, _ := token.Claims.(jwt.MapClaims)
+		if err := ValidateClaims(claims, config); err != nil {
+			respondUnauthorized(ctx, err)
+			return
+		}
+		if claims["typ"] == "refresh" {
+			respondUnauthorized(ctx, ErrRefreshTokenInvalid)
+			return
+		}
+		if store != nil {
+			if err := checkRevocation(store, claims); err != nil {
+				respondUnauthorized(ctx, err)
+				return
+			}
+		}
+		ctx.Values().Set(contextKey, claims)
+		ctx.Next()
+	}, nil
+}
+
+func ValidateClaims(claims jwt.MapClaims, config *toml.Tree) error {
+	leeway := GetDuration(config, "leeway")
+	now := time.Now()
+	if exp, ok := claims["exp"]; ok {
+		if now.After(time.Unix(ParseInt64(exp), 0).Add(leeway)) {
+			return ErrTokenExpired
+		}
+	} else if GetBool(config, "require-exp") {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims["nbf"]; ok {
+		if now.Before(time.Unix(ParseInt64(nbf), 0).Add(-leeway)) {
+			return ErrTokenNotValidYet
+		}
+	}
+	if iat, ok := claims["iat"]; ok {
+		if now.Before(time.Unix(ParseInt64(iat), 0).Add(-leeway)) {
+			return ErrTokenIssuedAt
+		}
+	}
+	if issuer := GetString(config, "issuer"); issuer != "" {
+		if ParseString(claims["iss"]) != issuer {
+			return ErrTokenIssuer
+		}
+	}
+	audiences := GetStringArray(config, "audience")
+	if len(audiences) == 0 && GetString(config, "audience") != "" {
+		audiences = []string{GetString(config, "audience")}
+	}
+	if len(audiences) > 0 {
+		accepted := false
+		values := []string{}
+		if audience, ok := claims["aud"].(string); ok {
+			values = append(values, audience)
+		} else {
+			values = ParseStringArray(claims["aud"])
+		}
+		for _, audience := range values {
+			if StringArrayContains(audiences, audience) {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return ErrTokenAudience
+		}
+	}
+	return nil
+}
+
+func checkRevocation(store RevocationStore, claims jwt.MapClaims) error {
+	for _, name := range []string{"jti", "fam"} {
+		if id := ParseString(claims[name]); id != "" {
+			revoked, err := store.IsRevoked(id)
+			if err != nil {
+				return err
+			}
+			if revoked {
+				return ErrTokenRevoked
+			}
+		}
+	}
+	return nil
+}
+
+func GetContextClaims(ctx iris.Context, key ...string) jwt.MapClaims {
+	contextKey := DefaultClaimsKey
+	if len(key) > 0 {
+		contextKey = key[0]
+	}
+	if claims, ok := ctx.Values().Get(contextKey).(jwt.MapClaims); ok {
+		return claims
+	}
+	return jwt.MapClaims{}
+}
+
+func respondUnauthorized(ctx iris.Context, err error) {
+	log.Println(err)
+	ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	ctx.StatusCode(iris.StatusUnauthorized)
+	ctx.JSON(iris.Map{
+		"success": false,
+		"code":    iris.StatusUnauthorized,
+		"error":   "invalid_token",
+		"message": err.Error(),
+	})
+	ctx.StopExecution()
+}
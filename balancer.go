@@ -0,0 +1,259 @@
+package iris_extend_helper
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+const (
+	BalanceOrdered          = "ordered"
+	BalanceRoundRobin       = "round-robin"
+	BalanceWeighted         = "weighted"
+	BalanceLeastOutstanding = "least-outstanding"
+	BalanceConsistentHash   = "consistent-hash"
+)
+
+var loadBalancers = struct {
+	sync.Mutex
+	balancers map[string]*LoadBalancer
+}{balancers: make(map[string]*LoadBalancer)}
+
+type balancerEndpoint struct {
+	url          string
+	weight       int
+	current      int
+	outstanding  int
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+type hashNode struct {
+	hash  uint32
+	index int
+}
+
+type EndpointStatus struct {
+	URL          string    `json:"url"`
+	Weight       int       `json:"weight"`
+	Outstanding  int       `json:"outstanding"`
+	Failures     int       `json:"failures"`
+	Ejections    int       `json:"ejections"`
+	Ejected      bool      `json:"ejected"`
+	EjectedUntil time.Time `json:"ejected_until"`
+}
+
+type LoadBalancer struct {
+	Policy        string
+	EjectErrors   int
+	EjectDuration time.Duration
+	endpoints     []*balancerEndpoint
+	ring          []hashNode
+	next          int
+	mutex         sync.Mutex
+}
+
+func NewLoadBalancer(endpoints []string, config *toml.Tree) *LoadBalancer {
+	weights := ParseUint64Array(config.Get("service-weights"))
+	lb := &LoadBalancer{
+		Policy:        GetString(config, "load-balancer", BalanceOrdered),
+		EjectErrors:   GetInt(config, "eject-consecutive-errors", 3),
+		EjectDuration: GetDuration(config, "eject-duration", 30*time.Second),
+		endpoints:     make([]*balancerEndpoint, 0, len(endpoints)),
+	}
+	for index, endpoint := range endpoints {
+		weight := 1
+		if index < len(weights) && weights[index] > 0 {
+			weight = int(weights[index])
+		}
+		lb.endpoints = append(lb.endpoints, &balancerEndpoint{url: endpoint, weight: weight})
+	}
+	if lb.Policy == BalanceConsistentHash {
+		replicas := GetInt(config, "hash-replicas", 100)
+		for index, endpoint := range lb.endpoints {
+			for i := 0; i < replicas*endpoint.weight; i++ {
+				hash := crc32.ChecksumIEEE([]byte(endpoint.url + "#" + strconv.Itoa(i)))
+				lb.ring = append(lb.ring, hashNode{hash: hash, index: index})
+			}
+		}
+		sort.Slice(lb.ring, func(i, j int) bool {
+			return lb.ring[i].hash < lb.ring[j].hash
+		})
+	}
+	return lb
+}
+
+// GetLoadBalancer returns the balancer shared by all calls to the same
+// endpoints, creating it from the config on first use.
+func GetLoadBalancer(endpoints []string, config *toml.Tree) *LoadBalancer {
+	name := GetString(config, "load-balancer", BalanceOrdered) + " " + strings.Join(endpoints, ",")
+	loadBalancers.Lock()
+	defer loadBalancers.Unlock()
+	lb, ok := loadBalancers.balancers[name]
+	if !ok {
+		lb = NewLoadBalancer(endpoints, config)
+		loadBalancers.balancers[name] = lb
+	}
+	return lb
+}
+
+// Endpoints returns the endpoints in the order they should be tried for
+// a request. Ejected endpoints are left out unless all of them are ejected.
+func (lb *LoadBalancer) Endpoints(key string) []string {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	length := len(lb.endpoints)
+	if length == 0 {
+		return make([]string, 0)
+	}
+	now := time.Now()
+	order := make([]int, 0, length)
+	switch lb.Policy {
+	case BalanceRoundRobin:
+		start := lb.next % length
+		lb.next += 1
+		for i := 0; i < length; i++ {
+			order = append(order, (start+i)%length)
+		}
+	case BalanceWeighted:
+		total := 0
+		best := 0
+		for index, endpoint := range lb.endpoints {
+			if now.Before(endpoint.ejectedUntil) {
+				continue
+			}
+			endpoint.current += endpoint.weight
+			total += endpoint.weight
+			if endpoint.current > lb.endpoints[best].current || now.Before(lb.endpoints[best].ejectedUntil) {
+				best = index
+			}
+		}
+		lb.endpoints[best].current -= total
+		order = append(order, best)
+		rest := make([]int, 0, length-1)
+		for index := range lb.endpoints {
+			if index != best {
+				rest = append(rest, index)
+			}
+		}
+		sort.SliceStable(rest, func(i, j int) bool {
+			return lb.endpoints[rest[i]].weight > lb.endpoints[rest[j]].weight
+		})
+		order = append(order, rest...)
+	case BalanceLeastOutstanding:
+		for index := range lb.endpoints {
+			order = append(order, index)
+		}
+		start := lb.next % length
+		lb.next += 1
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := lb.endpoints[order[i]], lb.endpoints[order[j]]
+			if a.outstanding != b.outstanding {
+				return a.outstanding < b.outstanding
+			}
+			return (order[i]-start+length)%length < (order[j]-start+length)%length
+		})
+	case BalanceConsistentHash:
+		if key != "" && len(lb.ring) > 0 {
+			hash := crc32.ChecksumIEEE([]byte(key))
+			start := sort.Search(len(lb.ring), func(i int) bool {
+				return lb.ring[i].hash >= hash
+			})
+			seen := make(map[int]bool)
+			for i := 0; i < len(lb.ring) && len(order) < length; i++ {
+				node := lb.ring[(start+i)%len(lb.ring)]
+				if !seen[node.index] {
+					seen[node.index] = true
+					order = append(order, node.index)
+				}
+			}
+			break
+		}
+		fallthrough
+	default:
+		for index := range lb.endpoints {
+			order = append(order, index)
+		}
+	}
+	healthy := make([]string, 0, length)
+	ejected := make([]string, 0)
+	for _, index := range order {
+		endpoint := lb.endpoints[index]
+		if now.Before(endpoint.ejectedUntil) {
+			ejected = append(ejected, endpoint.url)
+		} else {
+			healthy = append(healthy, endpoint.url)
+		}
+	}
+	if len(healthy) == 0 {
+		return ejected
+	}
+	return healthy
+}
+
+func (lb *LoadBalancer) Acquire(url string) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	if endpoint := lb.endpoint(url); endpoint != nil {
+		endpoint.outstanding += 1
+	}
+}
+
+// Release ends a request started with Acquire and records its outcome for
+// passive health tracking. Endpoints are ejected after consecutive errors
+// and re-admitted once the ejection duration has passed.
+func (lb *LoadBalancer) Release(url string, success bool) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	endpoint := lb.endpoint(url)
+	if endpoint == nil {
+		return
+	}
+	if endpoint.outstanding > 0 {
+		endpoint.outstanding -= 1
+	}
+	if success {
+		endpoint.failures = 0
+		return
+	}
+	endpoint.failures += 1
+	if lb.EjectErrors > 0 && endpoint.failures >= lb.EjectErrors {
+		endpoint.failures = 0
+		endpoint.ejections += 1
+		endpoint.ejectedUntil = time.Now().Add(lb.EjectDuration)
+	}
+}
+
+func (lb *LoadBalancer) Status() []EndpointStatus {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	now := time.Now()
+	states := make([]EndpointStatus, 0, len(lb.endpoints))
+	for _, endpoint := range lb.endpoints {
+		states = append(states, EndpointStatus{
+			URL:          endpoint.url,
+			Weight:       endpoint.weight,
+			Outstanding:  endpoint.outstanding,
+			Failures:     endpoint.failures,
+			Ejections:    endpoint.ejections,
+			Ejected:      now.Before(endpoint.ejectedUntil),
+			EjectedUntil: endpoint.ejectedUntil,
+		})
+	}
+	return states
+}
+
+func (lb *LoadBalancer) endpoint(url string) *balancerEndpoint {
+	for _, endpoint := range lb.endpoints {
+		if endpoint.url == url {
+			return endpoint
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package iris_extend_helper
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/pelletier/go-toml"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+var circuitBreakers = struct {
+	sync.Mutex
+	breakers map[string]*CircuitBreaker
+}{breakers: make(map[string]*CircuitBreaker)}
+
+type CircuitBreaker struct {
+	Name                string
+	FailureRate         float64
+	MinRequests         int
+	Window              int
+	ConsecutiveFailures int
+	CoolDown            time.Duration
+	HalfOpenRequests    int
+	state               string
+	results             []bool
+	offset              int
+	consecutive         int
+	openedAt            time.Time
+	probes              int
+	mutex               sync.Mutex
+}
+
+type BreakerStatus struct {
+	Name                string    `json:"name"`
+	State               string    `json:"state"`
+	Requests            int       `json:"requests"`
+	Failures            int       `json:"failures"`
+	FailureRate         float64   `json:"failure_rate"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenedAt            time.Time `json:"opened_at"`
+}
+
+func NewCircuitBreaker(name string, config *toml.Tree) *CircuitBreaker {
+	window := GetInt(config, "breaker-window", 20)
+	if window < 1 {
+		window = 1
+	}
+	return &CircuitBreaker{
+		Name:                name,
+		FailureRate:         GetFloat64(config, "breaker-failure-rate", 0.5),
+		MinRequests:         GetInt(config, "breaker-min-requests", 10),
+		Window:              window,
+		ConsecutiveFailures: GetInt(config, "breaker-consecutive-failures", 5),
+		CoolDown:            GetDuration(config, "breaker-cool-down", 30*time.Second),
+		HalfOpenRequests:    GetInt(config, "breaker-half-open-requests", 1),
+		state:               BreakerClosed,
+		results:             make([]bool, 0, window),
+	}
+}
+
+// GetCircuitBreaker returns the breaker shared by all calls to the endpoint,
+// creating it from the config on first use.
+func GetCircuitBreaker(endpoint string, config *toml.Tree) *CircuitBreaker {
+	name := breakerName(endpoint)
+	circuitBreakers.Lock()
+	defer circuitBreakers.Unlock()
+	breaker, ok := circuitBreakers.breakers[name]
+	if !ok {
+		breaker = NewCircuitBreaker(name, config)
+		circuitBreakers.breakers[name] = breaker
+	}
+	return breaker
+}
+
+func CircuitBreakerStates() []BreakerStatus {
+	circuitBreakers.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(circuitBreakers.breakers))
+	for _, breaker := range circuitBreakers.breakers {
+		breakers = append(breakers, breaker)
+	}
+	circuitBreakers.Unlock()
+	sort.Slice(breakers, func(i, j int) bool {
+		return breakers[i].Name < breakers[j].Name
+	})
+	states := make([]BreakerStatus, 0, len(breakers))
+	for _, breaker := range breakers {
+		states = append(states, breaker.Status())
+	}
+	return states
+}
+
+func ResetCircuitBreakers() {
+	circuitBreakers.Lock()
+	defer circuitBreakers.Unlock()
+	circuitBreakers.breakers = make(map[string]*CircuitBreaker)
+}
+
+func RegisterCircuitBreakerRoute(app *iris.Application, path string) {
+	app.Get(path, func(ctx iris.Context) {
+		ctx.JSON(iris.Map{"breakers": CircuitBreakerStates()})
+	})
+}
+
+func (b *CircuitBreaker) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.CoolDown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 1
+		return true
+	case BreakerHalfOpen:
+		if b.probes < b.HalfOpenRequests {
+			b.probes += 1
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func (b *CircuitBreaker) Record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		if success {
+			b.reset(BreakerClosed)
+		} else {
+			b.trip()
+		}
+	case BreakerClosed:
+		if len(b.results) < b.Window {
+			b.results = append(b.results, success)
+		} else {
+			b.results[b.offset] = success
+			b.offset = (b.offset + 1) % b.Window
+		}
+		if success {
+			b.consecutive = 0
+		} else {
+			b.consecutive += 1
+		}
+		requests, failures := b.counts()
+		if b.ConsecutiveFailures > 0 && b.consecutive >= b.ConsecutiveFailures {
+			b.trip()
+		} else if b.FailureRate > 0 && requests >= b.MinRequests && requests > 0 &&
+			float64(failures)/float64(requests) >= b.FailureRate {
+			b.trip()
+		}
+	}
+}
+
+func (b *CircuitBreaker) State() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.CoolDown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *CircuitBreaker) Status() BreakerStatus {
+	state := b.State()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	requests, failures := b.counts()
+	status := BreakerStatus{
+		Name:                b.Name,
+		State:               state,
+		Requests:            requests,
+		Failures:            failures,
+		ConsecutiveFailures: b.consecutive,
+		OpenedAt:            b.openedAt,
+	}
+	if requests > 0 {
+		status.FailureRate = float64(failures) / float64(requests)
+	}
+	return status
+}
+
+func (b *CircuitBreaker) trip() {
+	b.reset(BreakerOpen)
+	b.openedAt = time.Now()
+}
+
+func (b *CircuitBreaker) reset(state string) {
+	b.state = state
+	b.results = b.results[:0]
+	b.offset = 0
+	b.consecutive = 0
+	b.probes = 0
+	b.openedAt = time.Time{}
+}
+
+func (b *CircuitBreaker) counts() (int, int) {
+	failures := 0
+	for _, success := range b.results {
+		if !success {
+			failures += 1
+		}
+	}
+	return len(b.results), failures
+}
+
+func breakerName(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return endpoint
+}
+
+func breakerFailure(err error) bool {
+	var requestError *RequestError
+	if errors.As(err, &requestError) {
+		switch requestError.Kind {
+		case ErrStatus:
+			return requestError.StatusCode >= 500
+		case ErrEncode, ErrBodyTooLarge:
+			return false
+		}
+	}
+	return err != nil
+}
@@ -0,0 +1,274 @@
+package iris_extend_helper
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Vary       map[string]string
+	ExpiresAt  time.Time
+}
+
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+	size  int64
+}
+
+// MemoryCache is an LRU CacheStore bounded by the approximate size of the
+// cached responses in bytes.
+type MemoryCache struct {
+	MaxBytes int64
+	size     int64
+	items    map[string]*list.Element
+	order    *list.List
+	mutex    sync.Mutex
+}
+
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		MaxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// LoadCache builds a MemoryCache from the `max-size` key of the config,
+// which defaults to 64MB. LoadClient also reads `private` from the same
+// table to allow storing private responses.
+func LoadCache(config *toml.Tree) *MemoryCache {
+	size := 64
+	if config.Has("max-size") {
+		size = ParseMegabytes(config.Get("max-size"))
+	}
+	return NewMemoryCache(int64(size) * 1024 * 1024)
+}
+
+func (c *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*memoryCacheItem).entry, true
+}
+
+func (c *MemoryCache) Set(key string, entry *CacheEntry) {
+	size := int64(len(key) + len(entry.Body))
+	for name, values := range entry.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.remove(key)
+	if size > c.MaxBytes {
+		return
+	}
+	c.items[key] = c.order.PushFront(&memoryCacheItem{key: key, entry: entry, size: size})
+	c.size += size
+	for c.size > c.MaxBytes {
+		c.remove(c.order.Back().Value.(*memoryCacheItem).key)
+	}
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.remove(key)
+}
+
+func (c *MemoryCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+func (c *MemoryCache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+func (c *MemoryCache) remove(key string) {
+	if element, ok := c.items[key]; ok {
+		c.order.Remove(element)
+		delete(c.items, key)
+		c.size -= element.Value.(*memoryCacheItem).size
+	}
+}
+
+// doCached serves GET requests from the client cache, revalidating stale
+// entries with If-None-Match and If-Modified-Since. Requests with
+// Authorization or Cookie headers bypass the cache, since a Client is shared
+// between callers, and private responses are only stored when CachePrivate
+// is set.
+func (c *Client) doCached(ctx context.Context, request Request) (*Response, error) {
+	if request.Header.Get("Authorization") != "" || request.Header.Get("Cookie") != "" {
+		return c.do(ctx, request)
+	}
+	u, err := requestURL(request)
+	if err != nil {
+		return c.do(ctx, request)
+	}
+	key := http.MethodGet + " " + u.String()
+	directives := cacheControl(request.Header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return c.do(ctx, request)
+	}
+	entry, ok := c.Cache.Get(key)
+	if ok && !entry.matches(request.Header) {
+		entry, ok = nil, false
+	}
+	if ok {
+		if _, revalidate := directives["no-cache"]; !revalidate && time.Now().Before(entry.ExpiresAt) {
+			return entry.response(), nil
+		}
+		request.Header = request.Header.Clone()
+		if request.Header == nil {
+			request.Header = http.Header{}
+		}
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			request.Header.Set("If-Modified-Since", modified)
+		}
+	}
+	response, err := c.do(ctx, request)
+	var requestError *RequestError
+	if ok && errors.As(err, &requestError) && requestError.Kind == ErrStatus &&
+		requestError.StatusCode == http.StatusNotModified {
+		refreshed := &CacheEntry{
+			StatusCode: entry.StatusCode,
+			Header:     entry.Header.Clone(),
+			Body:       entry.Body,
+			Vary:       entry.Vary,
+		}
+		for name, values := range response.Header {
+			refreshed.Header[name] = values
+		}
+		if expiresAt, storable := cacheExpiry(refreshed.Header, c.CachePrivate); storable {
+			refreshed.ExpiresAt = expiresAt
+			c.Cache.Set(key, refreshed)
+		} else {
+			c.Cache.Delete(key)
+		}
+		return refreshed.response(), nil
+	}
+	if err != nil || response.StatusCode != http.StatusOK {
+		return response, err
+	}
+	expiresAt, storable := cacheExpiry(response.Header, c.CachePrivate)
+	vary := make(map[string]string)
+	for _, field := range strings.Split(response.Header.Get("Vary"), ",") {
+		if field = http.CanonicalHeaderKey(strings.TrimSpace(field)); field == "*" {
+			storable = false
+		} else if field != "" {
+			vary[field] = request.Header.Get(field)
+		}
+	}
+	if storable {
+		c.Cache.Set(key, &CacheEntry{
+			StatusCode: response.StatusCode,
+			Header:     response.Header.Clone(),
+			Body:       response.Body,
+			Vary:       vary,
+			ExpiresAt:  expiresAt,
+		})
+	} else if ok {
+		c.Cache.Delete(key)
+	}
+	return response, nil
+}
+
+func (e *CacheEntry) matches(header http.Header) bool {
+	for name, value := range e.Vary {
+		if header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *CacheEntry) response() *Response {
+	body := make([]byte, len(e.Body))
+	copy(body, e.Body)
+	return &Response{StatusCode: e.StatusCode, Header: e.Header.Clone(), Body: body}
+}
+
+// cacheExpiry returns when a response becomes stale and whether it may be
+// stored at all. Responses without freshness information are stored only
+// when they carry a validator, and are then revalidated on every use.
+// Private responses are stored only when private is set.
+func cacheExpiry(header http.Header, private bool) (time.Time, bool) {
+	now := time.Now()
+	directives := cacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return now, false
+	}
+	if _, ok := directives["private"]; ok && !private {
+		return now, false
+	}
+	validated := header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+	if _, ok := directives["no-cache"]; ok {
+		return now, validated
+	}
+	if value, ok := directives["max-age"]; ok {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			age, _ := strconv.ParseInt(header.Get("Age"), 10, 64)
+			if seconds > age {
+				return now.Add(time.Duration(seconds-age) * time.Second), true
+			}
+			return now, validated
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if expiresAt, err := http.ParseTime(expires); err == nil && expiresAt.After(now) {
+			if date, err := http.ParseTime(header.Get("Date")); err == nil {
+				return now.Add(expiresAt.Sub(date)), true
+			}
+			return expiresAt, true
+		}
+	}
+	return now, validated
+}
+
+func cacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		name := strings.ToLower(parts[0])
+		if name == "" {
+			continue
+		}
+		if len(parts) == 2 {
+			directives[name] = strings.Trim(parts[1], `"`)
+		} else {
+			directives[name] = ""
+		}
+	}
+	return directives
+}
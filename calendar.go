@@ -0,0 +1,235 @@
+package iris_extend_helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"github.com/robfig/cron/v3"
+)
+
+type Calendar struct {
+	Location *time.Location
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool
+}
+
+func NewCalendar(location *time.Location) *Calendar {
+	if location == nil {
+		location = time.Local
+	}
+	return &Calendar{
+		Location: location,
+		weekend:  map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+		holidays: make(map[string]bool),
+	}
+}
+
+func LoadCalendar(config *toml.Tree, location *time.Location) (*Calendar, error) {
+	calendar := NewCalendar(location)
+	if config.Has("weekend") {
+		weekend := make(map[time.Weekday]bool)
+		for _, name := range GetStringArray(config, "weekend") {
+			day, ok := parseWeekday(name)
+			if !ok {
+				return nil, fmt.Errorf("weekend: invalid weekday %q", name)
+			}
+			weekend[day] = true
+		}
+		calendar.weekend = weekend
+	}
+	for _, date := range GetStringArray(config, "holidays") {
+		if err := calendar.AddHoliday(date); err != nil {
+			return nil, err
+		}
+	}
+	if path := GetString(config, "holidays-file"); path != "" {
+		if err := calendar.LoadHolidays(path); err != nil {
+			return nil, err
+		}
+	}
+	return calendar, nil
+}
+
+func (c *Calendar) AddHoliday(date string) error {
+	day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(date), c.Location)
+	if err != nil {
+		return err
+	}
+	c.holidays[day.Format("2006-01-02")] = true
+	return nil
+}
+
+func (c *Calendar) LoadHolidays(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	number := 0
+	for scanner.Scan() {
+		number += 1
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if err := c.AddHoliday(strings.Fields(line)[0]); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	t = t.In(c.Location)
+	return !c.weekend[t.Weekday()] && !c.holidays[t.Format("2006-01-02")]
+}
+
+func (c *Calendar) BusinessDays(year int, month time.Month) []time.Time {
+	days := make([]time.Time, 0, 23)
+	day := time.Date(year, month, 1, 0, 0, 0, 0, c.Location)
+	for day.Month() == month {
+		if c.IsBusinessDay(day) {
+			days = append(days, day)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return days
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return time.Sunday, false
+}
+
+type BusinessDaySchedule struct {
+	Schedule cron.Schedule
+	Calendar *Calendar
+}
+
+// Next skips whole non-business days at once, restarting the wrapped
+// schedule from midnight of the next business day, so that frequent
+// schedules are not stepped tick by tick across weekends and holidays.
+func (s *BusinessDaySchedule) Next(t time.Time) time.Time {
+	next := s.Schedule.Next(t)
+	for i := 0; i < 1000 && !next.IsZero(); i++ {
+		if s.Calendar.IsBusinessDay(next) {
+			return next
+		}
+		local := next.In(s.Calendar.Location)
+		day := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, s.Calendar.Location)
+		for j := 0; j < 3660 && !s.Calendar.IsBusinessDay(day); j++ {
+			day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, s.Calendar.Location)
+		}
+		next = s.Schedule.Next(day.Add(-time.Second))
+	}
+	return time.Time{}
+}
+
+type MonthlyBusinessDaySchedule struct {
+	Nth      int
+	Hour     int
+	Minute   int
+	Second   int
+	Calendar *Calendar
+}
+
+func (s *MonthlyBusinessDaySchedule) Next(t time.Time) time.Time {
+	local := t.In(s.Calendar.Location)
+	year, month := local.Year(), local.Month()
+	for i := 0; i < 24; i++ {
+		days := s.Calendar.BusinessDays(year, month)
+		index := s.Nth - 1
+		if s.Nth < 0 {
+			index = len(days) + s.Nth
+		}
+		if index >= 0 && index < len(days) {
+			day := days[index]
+			next := time.Date(day.Year(), day.Month(), day.Day(), s.Hour, s.Minute, s.Second, 0, s.Calendar.Location)
+			if next.After(t) {
+				return next
+			}
+		}
+		month += 1
+		if month > time.December {
+			month = time.January
+			year += 1
+		}
+	}
+	return time.Time{}
+}
+
+func ParseBusinessDaySchedule(expr string, calendar *Calendar) (*MonthlyBusinessDaySchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) == 0 {
+		return nil, errors.New("empty schedule")
+	}
+	schedule := &MonthlyBusinessDaySchedule{Calendar: calendar}
+	switch fields[0] {
+	case "@first-business-day":
+		schedule.Nth = 1
+		fields = fields[1:]
+	case "@last-business-day":
+		schedule.Nth = -1
+		fields = fields[1:]
+	case "@business-day":
+		if len(fields) < 2 {
+			return nil, errors.New("@business-day requires a day number")
+		}
+		nth, err := strconv.Atoi(fields[1])
+		if err != nil || nth == 0 {
+			return nil, fmt.Errorf("invalid business day number %q", fields[1])
+		}
+		schedule.Nth = nth
+		fields = fields[2:]
+	default:
+		return nil, fmt.Errorf("unknown descriptor %q", fields[0])
+	}
+	if len(fields) > 1 {
+		return nil, fmt.Errorf("unexpected fields %q", strings.Join(fields[1:], " "))
+	}
+	if len(fields) == 1 {
+		parts := strings.Split(fields[0], ":")
+		values := []*int{&schedule.Hour, &schedule.Minute, &schedule.Second}
+		limits := []int{23, 59, 59}
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid time of day %q", fields[0])
+		}
+		for index, part := range parts {
+			value, err := strconv.Atoi(part)
+			if err != nil || value < 0 || value > limits[index] {
+				return nil, fmt.Errorf("invalid time of day %q", fields[0])
+			}
+			*values[index] = value
+		}
+	}
+	return schedule, nil
+}
+
+func isBusinessDayDescriptor(expr string) bool {
+	return strings.HasPrefix(expr, "@first-business-day") ||
+		strings.HasPrefix(expr, "@last-business-day") ||
+		strings.HasPrefix(expr, "@business-day")
+}
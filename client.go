@@ -0,0 +1,315 @@
+package iris_extend_helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/kataras/iris/v12"
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	ErrTransport = errors.New("transport failure")
+	ErrStatus    = errors.New("unexpected status")
+	ErrDecode    = errors.New("decode failure")
+	ErrEncode    = errors.New("encode failure")
+)
+
+type Request struct {
+	Method      string
+	URL         string
+	Query       url.Values
+	Header      http.Header
+	Body        []byte
+	Timeout     time.Duration
+	MaxBodySize int64
+	Progress    ProgressFunc
+	err         error
+}
+
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+type RequestError struct {
+	Kind       error
+	Method     string
+	URL        string
+	StatusCode int
+	Body       []byte
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	switch e.Kind {
+	case ErrStatus:
+		return fmt.Sprintf("%s %s: %v %d", e.Method, e.URL, e.Kind, e.StatusCode)
+	case ErrBodyTooLarge:
+		return fmt.Sprintf("%s %s: %v", e.Method, e.URL, e.Kind)
+	default:
+		return fmt.Sprintf("%s %s: %v: %v", e.Method, e.URL, e.Kind, e.Err)
+	}
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestError) Is(target error) bool {
+	return target == e.Kind
+}
+
+type Client struct {
+	HTTPClient   *http.Client
+	Timeout      time.Duration
+	Signer       Signer
+	Cache        CacheStore
+	CachePrivate bool
+}
+
+var defaultClient = NewClient(client)
+
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{HTTPClient: httpClient}
+}
+
+func LoadClient(config *toml.Tree) (*Client, error) {
+	tlsConfig, err := NewTLSConfig(GetTree(config, "tls"))
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConns:        GetInt(config, "max-idle-conns", 100),
+			MaxIdleConnsPerHost: GetInt(config, "max-idle-conns-per-host", 10),
+			IdleConnTimeout:     GetDuration(config, "idle-conn-timeout", 90*time.Second),
+		},
+	}
+	c := NewClient(httpClient)
+	c.Timeout = GetDuration(config, "timeout")
+	if signer, ok := config.Get("signer").(*toml.Tree); ok {
+		if c.Signer, err = LoadSigner(signer); err != nil {
+			return nil, err
+		}
+	}
+	if cache, ok := config.Get("cache").(*toml.Tree); ok {
+		c.Cache = LoadCache(cache)
+		c.CachePrivate = GetBool(cache, "private")
+	}
+	return c, nil
+}
+
+func LoadClients(config *toml.Tree) (map[string]*Client, error) {
+	clients := make(map[string]*Client)
+	for _, name := range config.Keys() {
+		tree, ok := config.Get(name).(*toml.Tree)
+		if !ok {
+			continue
+		}
+		c, err := LoadClient(tree)
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %w", name, err)
+		}
+		clients[name] = c
+	}
+	return clients, nil
+}
+
+func SetDefaultClient(c *Client) {
+	defaultClient = c
+}
+
+func (c *Client) Do(ctx context.Context, request Request) (*Response, error) {
+	method := strings.ToUpper(request.Method)
+	if c.Cache != nil && (method == "" || method == http.MethodGet) && request.Header.Get("Range") == "" {
+		return c.doCached(ctx, request)
+	}
+	return c.do(ctx, request)
+}
+
+func (c *Client) do(ctx context.Context, request Request) (*Response, error) {
+	req, cancel, err := c.newHTTPRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, &RequestError{Kind: ErrTransport, Method: req.Method, URL: request.URL, Err: err}
+	}
+	defer res.Body.Close()
+	response := &Response{StatusCode: res.StatusCode, Header: res.Header}
+	body := newProgressReader(limitBody(res, request.MaxBodySize), 0, res.ContentLength, request.Progress)
+	content, err := ioutil.ReadAll(body)
+	if errors.Is(err, ErrBodyTooLarge) {
+		return response, &RequestError{Kind: ErrBodyTooLarge, Method: req.Method, URL: request.URL, Err: err}
+	} else if err != nil {
+		return response, &RequestError{Kind: ErrTransport, Method: req.Method, URL: request.URL, Err: err}
+	}
+	response.Body = content
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return response, &RequestError{
+			Kind:       ErrStatus,
+			Method:     req.Method,
+			URL:        request.URL,
+			StatusCode: res.StatusCode,
+			Body:       content,
+		}
+	}
+	return response, nil
+}
+
+func (c *Client) newHTTPRequest(ctx context.Context, request Request) (*http.Request, context.CancelFunc, error) {
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if request.err != nil {
+		return nil, nil, &RequestError{Kind: ErrEncode, Method: method, URL: request.URL, Err: request.err}
+	}
+	fail := func(err error) *RequestError {
+		return &RequestError{Kind: ErrTransport, Method: method, URL: request.URL, Err: err}
+	}
+	u, err := requestURL(request)
+	if err != nil {
+		return nil, nil, fail(err)
+	}
+	timeout := request.Timeout
+	if timeout <= 0 {
+		timeout = c.Timeout
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	var body io.Reader
+	if request.Body != nil {
+		body = bytes.NewReader(request.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		cancel()
+		return nil, nil, fail(err)
+	}
+	if request.Header != nil {
+		req.Header = request.Header.Clone()
+	}
+	if c.Signer != nil {
+		if err := c.Signer.Sign(req, request.Body); err != nil {
+			cancel()
+			return nil, nil, fail(err)
+		}
+	}
+	return req, cancel, nil
+}
+
+func requestURL(request Request) (*url.URL, error) {
+	u, err := url.Parse(request.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("missing scheme in url %q", request.URL)
+	}
+	if len(request.Query) > 0 {
+		values := u.Query()
+		for key, value := range request.Query {
+			values[key] = value
+		}
+		u.RawQuery = values.Encode()
+	}
+	return u, nil
+}
+
+func (r *Response) Decode(value interface{}) error {
+	if err := jsoniter.Unmarshal(r.Body, value); err != nil {
+		return &RequestError{Kind: ErrDecode, StatusCode: r.StatusCode, Body: r.Body, Err: err}
+	}
+	return nil
+}
+
+// NewRequest builds a Request from a legacy request map. The method given
+// always wins, so that GetData cannot be turned into a POST by the map;
+// the `method` key is only read when method is empty. The `body` key is
+// only sent with POST, PUT and PATCH, so that a map shared between GetData
+// and PostData does not send a body with the GET; set Request.Body to send
+// one with other methods.
+func NewRequest(method string, request iris.Map) Request {
+	if method == "" {
+		method = ParseString(request["method"], http.MethodGet)
+	}
+	req := Request{
+		Method: strings.ToUpper(method),
+		URL:    ParseString(request["url"]),
+		Header: http.Header{},
+	}
+	if params, ok := request["url_params"]; ok {
+		req.Query = url.Values{}
+		for key, value := range ParseMap(params) {
+			req.Query.Set(key, ParseString(value))
+		}
+	}
+	if req.Method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if headers, ok := request["headers"]; ok {
+		for key, value := range ParseMap(headers) {
+			req.Header.Set(key, ParseString(value))
+		}
+	}
+	if timeout, ok := request["timeout"]; ok {
+		req.Timeout = time.Duration(ParseMilliseconds(timeout) * float64(time.Millisecond))
+	}
+	if size, ok := request["max_body_size"]; ok {
+		req.MaxBodySize = int64(ParseMegabytes(size)) * 1024 * 1024
+	}
+	hasBody := req.Method == http.MethodPost || req.Method == http.MethodPut || req.Method == http.MethodPatch
+	if body, ok := request["body"]; ok && hasBody {
+		content, contentType, err := EncodeBody(body, req.Header.Get("Content-Type"))
+		if err == nil {
+			req.Body = content
+			req.Header.Set("Content-Type", contentType)
+		} else if contentType != "" && !errors.Is(err, ErrBodyEncoder) {
+			req.err = err
+		} else {
+			req.Body = []byte(ParseString(body))
+		}
+	} else if req.Method == http.MethodPost {
+		req.Body = make([]byte, 0)
+	}
+	return req
+}
+
+func legacyResult(response *Response, err error) ([]byte, bool) {
+	if err != nil {
+		var requestError *RequestError
+		if errors.As(err, &requestError) && requestError.Kind == ErrStatus {
+			code := requestError.StatusCode
+			if code >= 200 && code < 400 {
+				return requestError.Body, true
+			}
+			log.Println(err)
+			return requestError.Body, false
+		}
+		log.Println(err)
+		return make([]byte, 0), false
+	}
+	return response.Body, true
+}
@@ -0,0 +1,252 @@
+package iris_extend_helper
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kataras/iris/v12"
+)
+
+var (
+	ErrBodyEncoder = errors.New("no body encoder for content type")
+	ErrXMLName     = errors.New("invalid xml element name")
+)
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// BodyEncoder encodes a request body and returns it with the content type
+// to send, which may add parameters such as a multipart boundary.
+type BodyEncoder func(body interface{}, contentType string) ([]byte, string, error)
+
+var bodyEncoders = struct {
+	sync.RWMutex
+	encoders map[string]BodyEncoder
+}{encoders: map[string]BodyEncoder{
+	"application/x-www-form-urlencoded": EncodeFormBody,
+	"application/json":                  EncodeJSONBody,
+	"application/xml":                   EncodeXMLBody,
+	"text/xml":                          EncodeXMLBody,
+	"multipart/form-data":               EncodeMultipartBody,
+}}
+
+// FilePart is a multipart file field read either from Path or Reader.
+type FilePart struct {
+	Filename    string
+	ContentType string
+	Path        string
+	Reader      io.Reader
+}
+
+func RegisterBodyEncoder(mediaType string, encoder BodyEncoder) {
+	bodyEncoders.Lock()
+	defer bodyEncoders.Unlock()
+	bodyEncoders.encoders[strings.ToLower(mediaType)] = encoder
+}
+
+func EncodeBody(body interface{}, contentType string) ([]byte, string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, contentType, err
+	}
+	bodyEncoders.RLock()
+	encoder, ok := bodyEncoders.encoders[mediaType]
+	if !ok {
+		if strings.HasSuffix(mediaType, "+json") {
+			encoder, ok = bodyEncoders.encoders["application/json"]
+		} else if strings.HasSuffix(mediaType, "+xml") {
+			encoder, ok = bodyEncoders.encoders["application/xml"]
+		}
+	}
+	bodyEncoders.RUnlock()
+	if !ok {
+		return nil, contentType, fmt.Errorf("%w %s", ErrBodyEncoder, mediaType)
+	}
+	return encoder(body, contentType)
+}
+
+func EncodeFormBody(body interface{}, contentType string) ([]byte, string, error) {
+	if content, ok := body.([]byte); ok {
+		return content, contentType, nil
+	}
+	values := url.Values{}
+	for key, value := range ParseMap(body) {
+		values.Set(key, ParseString(value))
+	}
+	return []byte(values.Encode()), contentType, nil
+}
+
+func EncodeJSONBody(body interface{}, contentType string) ([]byte, string, error) {
+	if content, ok := rawBody(body); ok {
+		return content, contentType, nil
+	}
+	if body == nil {
+		return make([]byte, 0), contentType, nil
+	}
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	content, err := json.Marshal(body)
+	return content, contentType, err
+}
+
+// EncodeXMLBody marshals structs with encoding/xml. Maps are written as
+// child elements of an <xml> root in key order.
+func EncodeXMLBody(body interface{}, contentType string) ([]byte, string, error) {
+	if content, ok := rawBody(body); ok {
+		return content, contentType, nil
+	}
+	value := reflect.ValueOf(body)
+	if value.Kind() != reflect.Map {
+		content, err := xml.Marshal(body)
+		return content, contentType, err
+	}
+	buffer := new(bytes.Buffer)
+	if err := writeXMLElement(buffer, "xml", body); err != nil {
+		return nil, contentType, err
+	}
+	return buffer.Bytes(), contentType, nil
+}
+
+func EncodeMultipartBody(body interface{}, contentType string) ([]byte, string, error) {
+	buffer := new(bytes.Buffer)
+	writer := multipart.NewWriter(buffer)
+	fields := ParseMap(body)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var err error
+		switch value := fields[key].(type) {
+		case FilePart:
+			err = writeFilePart(writer, key, &value)
+		case *FilePart:
+			err = writeFilePart(writer, key, value)
+		case io.Reader:
+			err = writeFilePart(writer, key, &FilePart{Reader: value})
+		default:
+			err = writer.WriteField(key, ParseString(value))
+		}
+		if err != nil {
+			return nil, contentType, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, contentType, err
+	}
+	return buffer.Bytes(), writer.FormDataContentType(), nil
+}
+
+func writeFilePart(writer *multipart.Writer, field string, part *FilePart) error {
+	reader := part.Reader
+	filename := part.Filename
+	if reader == nil {
+		file, err := os.Open(part.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+		if filename == "" {
+			filename = filepath.Base(part.Path)
+		}
+	}
+	if filename == "" {
+		filename = field
+	}
+	contentType := part.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(field), quoteEscaper.Replace(filename)))
+	header.Set("Content-Type", contentType)
+	w, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+func writeXMLElement(buffer *bytes.Buffer, name string, value interface{}) error {
+	if !isXMLName(name) {
+		return fmt.Errorf("%w %q", ErrXMLName, name)
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch value.(type) {
+	case iris.Map, map[string]string:
+		buffer.WriteString("<" + name + ">")
+		fields := ParseMap(value)
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXMLElement(buffer, key, fields[key]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteString("</" + name + ">")
+	case []interface{}:
+		for _, item := range value.([]interface{}) {
+			if err := writeXMLElement(buffer, name, item); err != nil {
+				return err
+			}
+		}
+	default:
+		encoder := xml.NewEncoder(buffer)
+		if err := encoder.EncodeElement(ParseString(value), start); err != nil {
+			return err
+		}
+		return encoder.Flush()
+	}
+	return nil
+}
+
+// isXMLName reports whether name is an XML Name, so that map keys cannot
+// inject markup or attributes into the encoded document.
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for index, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_' || r == ':':
+		case index > 0 && (unicode.IsDigit(r) || r == '-' || r == '.' || r == '\u00b7' ||
+			unicode.In(r, unicode.Mn, unicode.Mc)):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func rawBody(body interface{}) ([]byte, bool) {
+	switch body.(type) {
+	case []byte:
+		return body.([]byte), true
+	case string:
+		return []byte(body.(string)), true
+	}
+	return nil, false
+}
@@ -1,20 +1,196 @@
 package iris_extend_helper
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"runtime"
 	"strings"
 )
 
+type Frame struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function string `json:"function"`
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s#%v", f.File, f.Line)
+}
+
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+	Fields  map[string]interface{}
+	Stack   []Frame
+	cause   error
+}
+
+func NewError(code string, status int, message string) *Error {
+	return &Error{
+		Code:    code,
+		Status:  status,
+		Message: message,
+		Fields:  make(map[string]interface{}),
+		Stack:   callers(3),
+	}
+}
+
 func WrapError(err error) error {
 	if err != nil {
-		_, file, line, _ := runtime.Caller(1)
-		return fmt.Errorf("<%s#%v>%w", file, line, err)
+		return &Error{
+			Fields: make(map[string]interface{}),
+			Stack:  callers(3),
+			cause:  err,
+		}
 	}
 	return nil
 }
 
+func (e *Error) Error() string {
+	message := e.Message
+	if e.cause != nil {
+		if message != "" {
+			message += ": "
+		}
+		message += e.cause.Error()
+	}
+	if len(e.Stack) > 0 {
+		return "<" + e.Stack[0].String() + ">" + message
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func (e *Error) Is(target error) bool {
+	if t, ok := target.(*Error); ok {
+		return t.Code != "" && t.Code == e.Code
+	}
+	return false
+}
+
+func (e *Error) Wrap(err error) *Error {
+	e.cause = err
+	return e
+}
+
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+func (e *Error) WithStatus(status int) *Error {
+	e.Status = status
+	return e
+}
+
+func (e *Error) WithField(key string, value interface{}) *Error {
+	if e.Fields == nil {
+		e.Fields = make(map[string]interface{})
+	}
+	e.Fields[key] = value
+	return e
+}
+
+func callers(skip int) []Frame {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	stack := make([]Frame, 0, n)
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, Frame{File: frame.File, Line: frame.Line, Function: frame.Function})
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+func ErrorCode(err error) string {
+	for err != nil {
+		if e, ok := err.(*Error); ok && e.Code != "" {
+			return e.Code
+		}
+		err = errors.Unwrap(err)
+	}
+	return ""
+}
+
+func ErrorStatus(err error, values ...int) int {
+	for err != nil {
+		if e, ok := err.(*Error); ok && e.Status != 0 {
+			return e.Status
+		}
+		err = errors.Unwrap(err)
+	}
+	if len(values) > 0 {
+		return values[0]
+	}
+	return 0
+}
+
+func ErrorFields(err error) map[string]interface{} {
+	fields := make(map[string]interface{})
+	chain := make([]*Error, 0)
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			chain = append(chain, e)
+		}
+		err = errors.Unwrap(err)
+	}
+	for index := len(chain) - 1; index >= 0; index-- {
+		for key, value := range chain[index].Fields {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+func ErrorFrames(err error) []Frame {
+	frames := make([]Frame, 0)
+	for err != nil {
+		if e, ok := err.(*Error); ok && len(e.Stack) > 0 {
+			frames = append(frames, e.Stack[0])
+		}
+		err = errors.Unwrap(err)
+	}
+	return frames
+}
+
+func ErrorMessage(err error) string {
+	messages := make([]string, 0)
+	for err != nil {
+		e, ok := err.(*Error)
+		if !ok {
+			_, message, _ := ParseErrorSource(err.Error())
+			messages = append(messages, message)
+			break
+		}
+		if e.Message != "" {
+			messages = append(messages, e.Message)
+		}
+		err = e.cause
+	}
+	return strings.Join(messages, ": ")
+}
+
+func ErrorSource(err error) (string, string, bool) {
+	frames := ErrorFrames(err)
+	if len(frames) == 0 {
+		return ParseErrorSource(err.Error())
+	}
+	sources := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		sources = append(sources, frame.String())
+	}
+	return strings.Join(sources, ""), ErrorMessage(err), true
+}
+
 func ParseErrorSource(str string) (string, string, bool) {
 	re := regexp.MustCompile(`<[^<>]+#\d+>`)
 	matches := re.FindAllString(str, -1)
@@ -0,0 +1,347 @@
+package iris_extend_helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/kataras/iris/v12"
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	ErrCanonicalJSON  = errors.New("value cannot be canonicalized")
+	ErrDigestMissing  = errors.New("content digest is missing")
+	ErrDigestMismatch = errors.New("content digest does not match body")
+)
+
+// integrityAlgorithms lists the SRI hash algorithms from weakest to strongest.
+var integrityAlgorithms = []string{"sha256", "sha384", "sha512"}
+
+// CanonicalJSON encodes a value with the JSON Canonicalization Scheme of
+// RFC 8785: object keys sorted by UTF-16 code units, ECMAScript number
+// formatting and minimal string escaping.
+func CanonicalJSON(value interface{}) ([]byte, error) {
+	var content []byte
+	switch value.(type) {
+	case []byte:
+		content = value.([]byte)
+	case json.RawMessage:
+		content = value.(json.RawMessage)
+	default:
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		content = bytes
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var object interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	buffer := new(bytes.Buffer)
+	if err := writeCanonicalJSON(buffer, object); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeCanonicalJSON(buffer *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteString("null")
+	case bool:
+		buffer.WriteString(strconv.FormatBool(value))
+	case json.Number:
+		number, err := strconv.ParseFloat(string(value), 64)
+		if err != nil {
+			return err
+		}
+		str, err := canonicalNumber(number)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString(str)
+	case string:
+		writeCanonicalString(buffer, value)
+	case []interface{}:
+		buffer.WriteByte('[')
+		for index, item := range value {
+			if index > 0 {
+				buffer.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buffer, item); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := utf16.Encode([]rune(keys[i])), utf16.Encode([]rune(keys[j]))
+			for k := 0; k < len(a) && k < len(b); k++ {
+				if a[k] != b[k] {
+					return a[k] < b[k]
+				}
+			}
+			return len(a) < len(b)
+		})
+		buffer.WriteByte('{')
+		for index, key := range keys {
+			if index > 0 {
+				buffer.WriteByte(',')
+			}
+			writeCanonicalString(buffer, key)
+			buffer.WriteByte(':')
+			if err := writeCanonicalJSON(buffer, value[key]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('}')
+	default:
+		return fmt.Errorf("%w: %T", ErrCanonicalJSON, value)
+	}
+	return nil
+}
+
+func writeCanonicalString(buffer *bytes.Buffer, str string) {
+	buffer.WriteByte('"')
+	for _, r := range str {
+		switch r {
+		case '"':
+			buffer.WriteString(`\"`)
+		case '\\':
+			buffer.WriteString(`\\`)
+		case '\b':
+			buffer.WriteString(`\b`)
+		case '\f':
+			buffer.WriteString(`\f`)
+		case '\n':
+			buffer.WriteString(`\n`)
+		case '\r':
+			buffer.WriteString(`\r`)
+		case '\t':
+			buffer.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buffer.WriteString(fmt.Sprintf(`\u%04x`, r))
+			} else {
+				buffer.WriteRune(r)
+			}
+		}
+	}
+	buffer.WriteByte('"')
+}
+
+// canonicalNumber formats a number like ECMAScript Number.prototype.toString.
+func canonicalNumber(number float64) (string, error) {
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return "", fmt.Errorf("%w: %v", ErrCanonicalJSON, number)
+	}
+	if number == 0 {
+		return "0", nil
+	}
+	sign := ""
+	if number < 0 {
+		sign = "-"
+		number = -number
+	}
+	parts := strings.SplitN(strconv.FormatFloat(number, 'e', -1, 64), "e", 2)
+	digits := strings.Replace(parts[0], ".", "", 1)
+	exponent, _ := strconv.Atoi(parts[1])
+	k := len(digits)
+	n := exponent + 1
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+	str := digits[:1]
+	if k > 1 {
+		str += "." + digits[1:]
+	}
+	if n-1 >= 0 {
+		return sign + str + "e+" + strconv.Itoa(n-1), nil
+	}
+	return sign + str + "e" + strconv.Itoa(n-1), nil
+}
+
+func integrityDigest(algorithm string, content []byte) ([]byte, bool) {
+	switch algorithm {
+	case "sha256":
+		sum := sha256.Sum256(content)
+		return sum[:], true
+	case "sha384":
+		sum := sha512.Sum384(content)
+		return sum[:], true
+	case "sha512":
+		sum := sha512.Sum512(content)
+		return sum[:], true
+	}
+	return nil, false
+}
+
+// VerifyIntegrity checks a value against space separated SRI metadata such
+// as "sha384-... sha512-...". As in SRI, only digests of the strongest
+// listed algorithm are considered and any one of them may match. Unless
+// the canonicalization is configured, both legacy and jcs digests of JSON
+// objects are accepted, so that producers can move to jcs one at a time.
+func VerifyIntegrity(value interface{}, integrity string, config *toml.Tree) bool {
+	digests := make(map[string][]string)
+	for _, token := range strings.Fields(integrity) {
+		if index := strings.Index(token, "?"); index >= 0 {
+			token = token[:index]
+		}
+		parts := strings.SplitN(token, "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		algorithm := strings.ToLower(parts[0])
+		digests[algorithm] = append(digests[algorithm], parts[1])
+	}
+	canonicalizations := []string{"legacy", "jcs"}
+	if config.Has("canonicalization") {
+		canonicalizations = []string{GetString(config, "canonicalization")}
+	}
+	for index := len(integrityAlgorithms) - 1; index >= 0; index-- {
+		algorithm := integrityAlgorithms[index]
+		if len(digests[algorithm]) == 0 {
+			continue
+		}
+		for _, canonicalization := range canonicalizations {
+			sum, _ := integrityDigest(algorithm, integrityContent(value, canonicalization))
+			for _, digest := range digests[algorithm] {
+				expected, err := base64.StdEncoding.DecodeString(digest)
+				if err == nil && bytes.Equal(sum, expected) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+var contentDigestAlgorithms = map[string]string{
+	"sha-256": "sha256",
+	"sha-512": "sha512",
+}
+
+// ContentDigest returns a Content-Digest header value (RFC 9530) for the
+// body, using sha-256 or sha-512.
+func ContentDigest(body []byte, algorithm string) string {
+	sum, ok := integrityDigest(contentDigestAlgorithms[algorithm], body)
+	if !ok {
+		algorithm = "sha-256"
+		sum, _ = integrityDigest("sha256", body)
+	}
+	return algorithm + "=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+// VerifyContentDigest checks the body against a Content-Digest header or a
+// legacy RFC 3230 Digest header. Unknown algorithms are ignored.
+func VerifyContentDigest(body []byte, contentDigest string, digest string) error {
+	checked := false
+	for _, member := range strings.Split(contentDigest, ",") {
+		parts := strings.SplitN(strings.TrimSpace(member), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		sum, ok := integrityDigest(contentDigestAlgorithms[strings.ToLower(parts[0])], body)
+		if !ok {
+			continue
+		}
+		expected, err := base64.StdEncoding.DecodeString(strings.Trim(parts[1], ":"))
+		if err != nil || !bytes.Equal(sum, expected) {
+			return ErrDigestMismatch
+		}
+		checked = true
+	}
+	for _, member := range strings.Split(digest, ",") {
+		parts := strings.SplitN(strings.TrimSpace(member), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		sum, ok := integrityDigest(contentDigestAlgorithms[strings.ToLower(parts[0])], body)
+		if !ok {
+			continue
+		}
+		if base64.StdEncoding.EncodeToString(sum) != parts[1] {
+			return ErrDigestMismatch
+		}
+		checked = true
+	}
+	if !checked {
+		return ErrDigestMissing
+	}
+	return nil
+}
+
+// ContentDigestHandler validates the digest of incoming request bodies and
+// sets Content-Digest, and optionally the legacy Digest header, on the
+// response.
+func ContentDigestHandler(config *toml.Tree) iris.Handler {
+	algorithm := GetString(config, "digest-algorithm", "sha-256")
+	requireDigest := GetBool(config, "require-digest")
+	legacyDigest := GetBool(config, "legacy-digest")
+	return func(ctx iris.Context) {
+		req := ctx.Request()
+		contentDigest := req.Header.Get("Content-Digest")
+		digest := req.Header.Get("Digest")
+		if contentDigest != "" || digest != "" || (requireDigest && req.ContentLength != 0) {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				respondDigestError(ctx, err)
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			if err := VerifyContentDigest(body, contentDigest, digest); err != nil {
+				if err != ErrDigestMissing || requireDigest {
+					respondDigestError(ctx, err)
+					return
+				}
+			}
+		}
+		ctx.Record()
+		ctx.Next()
+		body := ctx.Recorder().Body()
+		ctx.Header("Content-Digest", ContentDigest(body, algorithm))
+		if legacyDigest {
+			sum, ok := integrityDigest(contentDigestAlgorithms[algorithm], body)
+			if ok {
+				ctx.Header("Digest", strings.ToUpper(algorithm)+"="+base64.StdEncoding.EncodeToString(sum))
+			}
+		}
+	}
+}
+
+func respondDigestError(ctx iris.Context, err error) {
+	log.Println(err)
+	ctx.StatusCode(iris.StatusBadRequest)
+	ctx.JSON(iris.Map{
+		"success": false,
+		"code":    iris.StatusBadRequest,
+		"error":   "invalid_digest",
+		"message": err.Error(),
+	})
+	ctx.StopExecution()
+}
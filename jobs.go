@@ -0,0 +1,104 @@
+package iris_extend_helper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+type TaskRegistry map[string]func(ctx context.Context) error
+
+func (r TaskRegistry) Register(name string, task func(ctx context.Context) error) {
+	r[name] = task
+}
+
+func LoadJobs(config *toml.Tree, tasks TaskRegistry) ([]Job, error) {
+	jobs := make([]Job, 0)
+	errs := JobErrors{}
+	names := config.Keys()
+	sort.Strings(names)
+	for _, name := range names {
+		tree, ok := config.Get(name).(*toml.Tree)
+		if !ok {
+			errs = append(errs, &JobError{Name: name, Err: fmt.Errorf("expected a table, got %T", config.Get(name))})
+			continue
+		}
+		if !GetBool(tree, "enabled", true) {
+			continue
+		}
+		job, err := loadJob(name, tree, tasks)
+		if err == nil {
+			_, err = ParseJobSchedule(job)
+		}
+		if err == nil {
+			err = validateJob(job)
+		}
+		if err != nil {
+			errs = append(errs, &JobError{Name: name, Err: err})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if len(errs) > 0 {
+		return jobs, errs
+	}
+	return jobs, nil
+}
+
+func loadJob(name string, tree *toml.Tree, tasks TaskRegistry) (Job, error) {
+	job := Job{
+		Name:            name,
+		Schedule:        GetString(tree, "schedule"),
+		Timezone:        GetString(tree, "timezone"),
+		Overlap:         GetString(tree, "overlap"),
+		MaxRetries:      GetInt(tree, "max-retries"),
+		BackoffStrategy: GetString(tree, "backoff-strategy"),
+	}
+	if job.Schedule == "" {
+		return job, fmt.Errorf("schedule is required")
+	}
+	taskName := GetString(tree, "task", name)
+	task, ok := tasks[taskName]
+	if !ok {
+		return job, fmt.Errorf("no task registered as %q", taskName)
+	}
+	job.Run = task
+	keys := []string{"timeout", "jitter", "initial-backoff", "lock-ttl"}
+	fields := []*time.Duration{&job.Timeout, &job.Jitter, &job.InitialBackoff, &job.LockTTL}
+	for index, key := range keys {
+		field := fields[index]
+		if !tree.Has(key) {
+			continue
+		}
+		duration, err := time.ParseDuration(GetString(tree, key))
+		if err != nil {
+			return job, fmt.Errorf("%s: %w", key, err)
+		}
+		*field = duration
+	}
+	if tree.Has("weekend") || tree.Has("holidays") || tree.Has("holidays-file") {
+		location, err := loadLocation(job.Timezone)
+		if err != nil {
+			return job, err
+		}
+		calendar, err := LoadCalendar(tree, location)
+		if err != nil {
+			return job, err
+		}
+		job.Calendar = calendar
+	}
+	if tree.Has("anchor") {
+		anchor, ok := tree.Get("anchor").(time.Time)
+		if !ok {
+			anchor, ok = ParseTimestamp(GetString(tree, "anchor"))
+		}
+		if !ok {
+			return job, fmt.Errorf("anchor: invalid timestamp %q", GetString(tree, "anchor"))
+		}
+		job.Anchor = anchor
+	}
+	return job, nil
+}
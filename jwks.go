@@ -0,0 +1,440 @@
+package iris_extend_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/kataras/iris/v12"
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	ErrKeySetUnknownKey = errors.New("jwks: no key matches the token kid")
+	ErrKeySetAlgorithm  = errors.New("jwks: token alg does not match the key")
+)
+
+type KeyLookup interface {
+	LookupKey(kid string) (*SigningKey, error)
+}
+
+type SigningKey struct {
+	Kid        string
+	Alg        string
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+type KeySet struct {
+	keys    map[string]*SigningKey
+	order   []string
+	signing string
+	mutex   sync.RWMutex
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func NewKeySet(config *toml.Tree) (*KeySet, error) {
+	keySet := &KeySet{keys: make(map[string]*SigningKey)}
+	trees, _ := config.Get("keys").([]*toml.Tree)
+	for index, tree := range trees {
+		key := &SigningKey{Kid: GetString(tree, "kid")}
+		if tree.Has("hash") {
+			method, err := GetSigningMethod(tree)
+			if err != nil {
+				return nil, fmt.Errorf("jwks: keys[%d]: %w", index, err)
+			}
+			key.Alg = method.Alg()
+		}
+		if str := GetString(tree, "private-key"); str != "" {
+			key.PrivateKey = SigningKeyDecodeString(str)
+			if signer, ok := key.PrivateKey.(crypto.Signer); ok {
+				key.PublicKey = signer.Public()
+			}
+		}
+		if str := GetString(tree, "public-key"); str != "" {
+			key.PublicKey = VerifyingKeyDecodeString(str)
+		}
+		if err := keySet.Add(key); err != nil {
+			return nil, fmt.Errorf("jwks: keys[%d]: %w", index, err)
+		}
+	}
+	if kid := GetString(config, "signing-kid"); kid != "" {
+		if err := keySet.SetSigningKey(kid); err != nil {
+			return nil, err
+		}
+	}
+	return keySet, nil
+}
+
+func ParseKeySet(data []byte) (*KeySet, error) {
+	document := JSONWebKeySet{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	keySet := &KeySet{keys: make(map[string]*SigningKey)}
+	for index, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks: keys[%d]: %w", index, err)
+		}
+		key := &SigningKey{Kid: jwk.Kid, Alg: jwk.Alg, PublicKey: publicKey}
+		if err := keySet.Add(key); err != nil {
+			return nil, fmt.Errorf("jwks: keys[%d]: %w", index, err)
+		}
+	}
+	return keySet, nil
+}
+
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeySet(data)
+}
+
+func (ks *KeySet) Add(key *SigningKey) error {
+	if key.Kid == "" {
+		return errors.New("key has no kid")
+	}
+	if key.PublicKey == nil {
+		return fmt.Errorf("key %q has no public key", key.Kid)
+	}
+	if key.Alg == "" {
+		key.Alg = defaultKeyAlg(key.PublicKey)
+	}
+	if !keyMatchesAlg(key.PublicKey, key.Alg) {
+		return fmt.Errorf("key %q cannot be used with alg %q", key.Kid, key.Alg)
+	}
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	if _, ok := ks.keys[key.Kid]; ok {
+		return fmt.Errorf("duplicate kid %q", key.Kid)
+	}
+	ks.keys[key.Kid] = key
+	ks.order = append(ks.order, key.Kid)
+	if ks.signing == "" && key.PrivateKey != nil {
+		ks.signing = key.Kid
+	}
+	return nil
+}
+
+func (ks *KeySet) SetSigningKey(kid string) error {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	key, ok := ks.keys[kid]
+	if !ok {
+		return ErrKeySetUnknownKey
+	}
+	if key.PrivateKey == nil {
+		return fmt.Errorf("jwks: key %q has no private key", kid)
+	}
+	ks.signing = kid
+	return nil
+}
+
+func (ks *KeySet) LookupKey(kid string) (*SigningKey, error) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+	if kid == "" && len(ks.order) == 1 {
+		return ks.keys[ks.order[0]], nil
+	}
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrKeySetUnknownKey
+}
+
+func (ks *KeySet) SignClaims(claims jwt.MapClaims, config *toml.Tree) string {
+	ks.mutex.RLock()
+	key := ks.keys[ks.signing]
+	ks.mutex.RUnlock()
+	if key == nil {
+		log.Println("jwks: no signing key configured")
+		return ""
+	}
+	setDefaultClaims(claims, config)
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Alg), claims)
+	token.Header["kid"] = key.Kid
+	str, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		log.Println(err)
+	}
+	return str
+}
+
+func (ks *KeySet) JSONWebKeySet() JSONWebKeySet {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+	document := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(ks.order))}
+	for _, kid := range ks.order {
+		key := ks.keys[kid]
+		if jwk, ok := NewJSONWebKey(key.PublicKey); ok {
+			jwk.Kid = key.Kid
+			jwk.Alg = key.Alg
+			jwk.Use = "sig"
+			document.Keys = append(document.Keys, jwk)
+		}
+	}
+	return document
+}
+
+func NewJSONWebKey(key crypto.PublicKey) (JSONWebKey, bool) {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			Kty: "RSA",
+			N:   Base64Encode(string(key.N.Bytes())),
+			E:   Base64Encode(string(big.NewInt(int64(key.E)).Bytes())),
+		}, true
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return JSONWebKey{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   Base64Encode(string(key.X.FillBytes(make([]byte, size)))),
+			Y:   Base64Encode(string(key.Y.FillBytes(make([]byte, size)))),
+		}, true
+	case ed25519.PublicKey:
+		return JSONWebKey{Kty: "OKP", Crv: "Ed25519", X: Base64Encode(string(key))}, true
+	}
+	return JSONWebKey{}, false
+}
+
+func (jwk JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n := new(big.Int).SetBytes([]byte(Base64Decode(jwk.N)))
+		e := new(big.Int).SetBytes([]byte(Base64Decode(jwk.E)))
+		if n.Sign() == 0 || !e.IsInt64() || e.Int64() < 3 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x := new(big.Int).SetBytes([]byte(Base64Decode(jwk.X)))
+		y := new(big.Int).SetBytes([]byte(Base64Decode(jwk.Y)))
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		x := []byte(Base64Decode(jwk.X))
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func defaultKeyAlg(key crypto.PublicKey) string {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return "RS256"
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 384:
+			return "ES384"
+		case 521:
+			return "ES512"
+		}
+		return "ES256"
+	case ed25519.PublicKey:
+		return "EdDSA"
+	}
+	return ""
+}
+
+func keyMatchesAlg(key crypto.PublicKey, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return alg == defaultKeyAlg(key)
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
+
+func RegisterKeySet(app *iris.Application, path string, keys *KeySet) {
+	if path == "" {
+		path = "/.well-known/jwks.json"
+	}
+	app.Get(path, func(ctx iris.Context) {
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.ContentType("application/jwk-set+json")
+		ctx.Write(GetJSON(keys.JSONWebKeySet()))
+	})
+}
+
+// RemoteKeySet caches a key set fetched from a JWKS endpoint. Fetches run
+// with Timeout and outside the mutex, and failed attempts count against
+// MinRefresh like successful ones, so an unreachable endpoint neither
+// blocks nor is retried by every lookup.
+type RemoteKeySet struct {
+	Request    iris.Map
+	Timeout    time.Duration
+	MaxAge     time.Duration
+	MinRefresh time.Duration
+	keys       *KeySet
+	fetched    time.Time
+	attempted  time.Time
+	mutex      sync.Mutex
+}
+
+func NewRemoteKeySet(rawurl string, config *toml.Tree) *RemoteKeySet {
+	return &RemoteKeySet{
+		Request:    iris.Map{"url": rawurl},
+		Timeout:    GetDuration(config, "jwks-timeout", 10*time.Second),
+		MaxAge:     GetDuration(config, "jwks-max-age", time.Hour),
+		MinRefresh: GetDuration(config, "jwks-min-refresh", time.Minute),
+	}
+}
+
+func (rks *RemoteKeySet) Refresh() error {
+	rks.mutex.Lock()
+	rks.attempted = time.Now()
+	rks.mutex.Unlock()
+	_, err := rks.fetch()
+	return err
+}
+
+func (rks *RemoteKeySet) fetch() (*KeySet, error) {
+	request := NewRequest(http.MethodGet, rks.Request)
+	if request.Timeout <= 0 {
+		request.Timeout = rks.Timeout
+	}
+	response, err := defaultClient.Do(context.Background(), request)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: failed to fetch %v: %w", rks.Request["url"], err)
+	}
+	keys, err := ParseKeySet(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	rks.mutex.Lock()
+	defer rks.mutex.Unlock()
+	rks.keys = keys
+	rks.fetched = time.Now()
+	return keys, nil
+}
+
+// claim returns the cached key set and whether the caller should refresh
+// it, recording the attempt so that concurrent lookups keep using the
+// cached keys instead of fetching as well.
+func (rks *RemoteKeySet) claim(force bool) (*KeySet, bool) {
+	rks.mutex.Lock()
+	defer rks.mutex.Unlock()
+	stale := force || rks.keys == nil || time.Since(rks.fetched) > rks.MaxAge
+	if !stale || time.Since(rks.attempted) < rks.MinRefresh {
+		return rks.keys, false
+	}
+	rks.attempted = time.Now()
+	return rks.keys, true
+}
+
+func (rks *RemoteKeySet) LookupKey(kid string) (*SigningKey, error) {
+	keys, refresh := rks.claim(false)
+	if refresh {
+		if fetched, err := rks.fetch(); err != nil && keys == nil {
+			return nil, err
+		} else if err != nil {
+			log.Println(err)
+		} else {
+			keys = fetched
+		}
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("jwks: key set %v is unavailable", rks.Request["url"])
+	}
+	key, err := keys.LookupKey(kid)
+	if err != ErrKeySetUnknownKey {
+		return key, err
+	}
+	if _, refresh := rks.claim(true); refresh {
+		fetched, err := rks.fetch()
+		if err != nil {
+			log.Println(err)
+			return nil, ErrKeySetUnknownKey
+		}
+		return fetched.LookupKey(kid)
+	}
+	return key, err
+}
+
+func keySetKeyfunc(keys KeyLookup) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := keys.LookupKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Alg {
+			return nil, ErrKeySetAlgorithm
+		}
+		return key.PublicKey, nil
+	}
+}
+
+func ParseTokenWithKeySet(str string, keys KeyLookup, config ...*toml.Tree) (jwt.MapClaims, bool) {
+	parser := &jwt.Parser{}
+	if len(config) > 0 && config[0].Has("hash") {
+		method, err := GetSigningMethod(config[0])
+		if err != nil {
+			log.Println(err)
+			return jwt.MapClaims{}, false
+		}
+		parser.ValidMethods = []string{method.Alg()}
+	}
+	token, err := parser.Parse(str, keySetKeyfunc(keys))
+	if err != nil {
+		log.Println(err)
+	} else if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		return claims, true
+	}
+	return jwt.MapClaims{}, false
+}
@@ -2,6 +2,7 @@ package iris_extend_helper
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha256"
@@ -9,6 +10,8 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -19,6 +22,50 @@ import (
 	"github.com/pelletier/go-toml"
 )
 
+type SigningMethodEd25519 struct{}
+
+var SigningMethodEdDSA = &SigningMethodEd25519{}
+
+var (
+	ErrSigningMethod       = errors.New("unsupported token signing method")
+	ErrSigningKeyMissing   = errors.New("token signing key is missing")
+	ErrVerifyingKeyMissing = errors.New("token verifying key is missing")
+)
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *SigningMethodEd25519) Alg() string {
+	return "EdDSA"
+}
+
+func (m *SigningMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok || len(privateKey) != ed25519.PrivateKeySize {
+		return "", jwt.ErrInvalidKeyType
+	}
+	signature := ed25519.Sign(privateKey, []byte(signingString))
+	return jwt.EncodeSegment(signature), nil
+}
+
+func (m *SigningMethodEd25519) Verify(signingString string, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok || len(publicKey) != ed25519.PublicKeySize {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return errors.New("ed25519: verification error")
+	}
+	return nil
+}
+
 func Base64Encode(str string) string {
 	return base64.RawURLEncoding.EncodeToString([]byte(str))
 }
@@ -151,13 +198,31 @@ func Sign512(claims jwt.MapClaims, secret string) string {
 	return str
 }
 
-func SignClaims(claims jwt.MapClaims, config *toml.Tree, key ...string) string {
-	secret := ""
-	if GetBool(config, "use-global-key") {
-		secret = GetString(config, "key")
-	} else if len(key) > 0 {
-		secret = key[0]
+func SignWithKey(claims jwt.Claims, method jwt.SigningMethod, key interface{}) string {
+	token := jwt.NewWithClaims(method, claims)
+	str, err := token.SignedString(key)
+	if err != nil {
+		log.Println(err)
+	}
+	return str
+}
+
+// GetSigningMethod returns the method named by the `hash` key, HS256 by
+// default. Unknown names are an error rather than a fallback to HS256, which
+// would let a misspelled asymmetric method verify HMAC tokens signed with
+// the public key.
+func GetSigningMethod(config *toml.Tree) (jwt.SigningMethod, error) {
+	hash := strings.ToUpper(GetString(config, "hash", "HS256"))
+	if hash == "EDDSA" {
+		return SigningMethodEdDSA, nil
+	}
+	if method := jwt.GetSigningMethod(hash); method != nil {
+		return method, nil
 	}
+	return nil, fmt.Errorf("%w %q", ErrSigningMethod, GetString(config, "hash"))
+}
+
+func setDefaultClaims(claims jwt.MapClaims, config *toml.Tree) {
 	if claims["exp"] == nil && config.Has("max-age") {
 		maxAge := GetDuration(config, "max-age")
 		claims["exp"] = time.Now().Add(maxAge).Unix()
@@ -169,8 +234,31 @@ func SignClaims(claims jwt.MapClaims, config *toml.Tree, key ...string) string {
 		period := GetDuration(config, "lockup-period")
 		claims["nbf"] = time.Now().Add(period).Unix()
 	}
-	hash := strings.ToUpper(GetString(config, "hash", "HS256"))
-	switch hash {
+}
+
+func SignClaims(claims jwt.MapClaims, config *toml.Tree, key ...string) string {
+	secret := ""
+	method, err := GetSigningMethod(config)
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+	_, isHMAC := method.(*jwt.SigningMethodHMAC)
+	if GetBool(config, "use-global-key") {
+		if isHMAC {
+			secret = GetString(config, "key")
+		} else {
+			secret = GetString(config, "private-key")
+		}
+	} else if len(key) > 0 {
+		secret = key[0]
+	}
+	if secret == "" {
+		log.Println(ErrSigningKeyMissing)
+		return ""
+	}
+	setDefaultClaims(claims, config)
+	switch method.Alg() {
 	case "HS256":
 		return Sign256(claims, secret)
 	case "HS384":
@@ -178,7 +266,7 @@ func SignClaims(claims jwt.MapClaims, config *toml.Tree, key ...string) string {
 	case "HS512":
 		return Sign512(claims, secret)
 	default:
-		return Sign256(claims, secret)
+		return SignWithKey(claims, method, SigningKeyDecodeString(secret))
 	}
 }
 
@@ -214,9 +302,43 @@ func ExtractToken(req *http.Request, config *toml.Tree) string {
 	return token
 }
 
-func ParseToken(str string, key string) (jwt.MapClaims, bool) {
-	token, err := jwt.Parse(str, func(token *jwt.Token) (interface{}, error) {
-		return []byte(key), nil
+func tokenVerifier(key string, config ...*toml.Tree) ([]string, interface{}, error) {
+	methods := []string{"HS256", "HS384", "HS512"}
+	if len(config) > 0 {
+		method, err := GetSigningMethod(config[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		methods = []string{method.Alg()}
+		if _, ok := method.(*jwt.SigningMethodHMAC); !ok {
+			if key == "" {
+				key = GetString(config[0], "public-key")
+			}
+			verifyingKey := VerifyingKeyDecodeString(key)
+			if verifyingKey == nil {
+				return methods, nil, ErrVerifyingKeyMissing
+			}
+			return methods, verifyingKey, nil
+		}
+		if key == "" {
+			key = GetString(config[0], "key")
+		}
+	}
+	if key == "" {
+		return methods, nil, ErrVerifyingKeyMissing
+	}
+	return methods, []byte(key), nil
+}
+
+func ParseToken(str string, key string, config ...*toml.Tree) (jwt.MapClaims, bool) {
+	methods, verifyingKey, err := tokenVerifier(key, config...)
+	if err != nil {
+		log.Println(err)
+		return jwt.MapClaims{}, false
+	}
+	parser := &jwt.Parser{ValidMethods: methods}
+	token, err := parser.Parse(str, func(token *jwt.Token) (interface{}, error) {
+		return verifyingKey, nil
 	})
 	if err != nil {
 		log.Println(err)
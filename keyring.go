@@ -0,0 +1,208 @@
+package iris_extend_helper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml"
+)
+
+const (
+	KeyStatusActive      = "active"
+	KeyStatusDecryptOnly = "decrypt-only"
+	KeyStatusRetired     = "retired"
+)
+
+var (
+	ErrKeyringNoActiveKey = errors.New("keyring: no active key")
+	ErrKeyringUnknownKey  = errors.New("keyring: unknown key id")
+	ErrKeyringRetiredKey  = errors.New("keyring: key has been retired")
+)
+
+type KeyringKey struct {
+	Id     string
+	Key    string
+	Status string
+}
+
+type Keyring struct {
+	Algorithm string
+	keys      map[string]KeyringKey
+	order     []string
+	active    string
+	mutex     sync.RWMutex
+}
+
+func NewKeyring(config *toml.Tree) (*Keyring, error) {
+	keyring := &Keyring{
+		Algorithm: strings.ToUpper(GetString(config, "algorithm", AeadAesGcm)),
+		keys:      make(map[string]KeyringKey),
+	}
+	if _, ok := aeadAlgorithms[keyring.Algorithm]; !ok {
+		return nil, ErrAeadAlgorithm
+	}
+	trees, _ := config.Get("keys").([]*toml.Tree)
+	for index, tree := range trees {
+		key := KeyringKey{
+			Id:     GetString(tree, "id"),
+			Key:    GetString(tree, "key"),
+			Status: strings.ToLower(GetString(tree, "status", KeyStatusDecryptOnly)),
+		}
+		if err := keyring.Add(key); err != nil {
+			return nil, fmt.Errorf("keyring: keys[%d]: %w", index, err)
+		}
+	}
+	if keyring.active == "" {
+		return nil, ErrKeyringNoActiveKey
+	}
+	return keyring, nil
+}
+
+func (k *Keyring) Add(key KeyringKey) error {
+	if key.Id == "" || len(key.Id) > 255 {
+		return errors.New("key id must be between 1 and 255 bytes")
+	}
+	if key.Key == "" {
+		return fmt.Errorf("key %q has no key material", key.Id)
+	}
+	switch key.Status {
+	case KeyStatusActive, KeyStatusDecryptOnly, KeyStatusRetired:
+	default:
+		return fmt.Errorf("key %q has invalid status %q", key.Id, key.Status)
+	}
+	if _, err := newAead(aeadAlgorithms[k.Algorithm], []byte(Base64Decode(key.Key))); err != nil {
+		return fmt.Errorf("key %q: %w", key.Id, err)
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, ok := k.keys[key.Id]; ok {
+		return fmt.Errorf("duplicate key id %q", key.Id)
+	}
+	if key.Status == KeyStatusActive {
+		if k.active != "" {
+			return fmt.Errorf("key %q: only one key may be active", key.Id)
+		}
+		k.active = key.Id
+	}
+	k.keys[key.Id] = key
+	k.order = append(k.order, key.Id)
+	return nil
+}
+
+func (k *Keyring) ActiveKeyId() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.active
+}
+
+func (k *Keyring) Rotate(id string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return ErrKeyringUnknownKey
+	}
+	if key.Status == KeyStatusRetired {
+		return ErrKeyringRetiredKey
+	}
+	if previous, ok := k.keys[k.active]; ok {
+		previous.Status = KeyStatusDecryptOnly
+		k.keys[previous.Id] = previous
+	}
+	key.Status = KeyStatusActive
+	k.keys[id] = key
+	k.active = id
+	return nil
+}
+
+func (k *Keyring) Retire(id string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return ErrKeyringUnknownKey
+	}
+	if id == k.active {
+		return fmt.Errorf("keyring: cannot retire active key %q", id)
+	}
+	key.Status = KeyStatusRetired
+	k.keys[id] = key
+	return nil
+}
+
+func (k *Keyring) Encrypt(text string, data ...string) (string, error) {
+	k.mutex.RLock()
+	key, ok := k.keys[k.active]
+	k.mutex.RUnlock()
+	if !ok {
+		return "", ErrKeyringNoActiveKey
+	}
+	header := []byte{aeadEnvelopeV2, aeadAlgorithms[k.Algorithm], byte(len(key.Id))}
+	header = append(header, key.Id...)
+	return sealEnvelope(header, []byte(Base64Decode(key.Key)), []byte(text), data)
+}
+
+func (k *Keyring) Decrypt(text string, data ...string) (string, error) {
+	plaintext, _, err := k.decrypt(text, data)
+	return plaintext, err
+}
+
+func (k *Keyring) Reencrypt(text string, data ...string) (string, bool, error) {
+	plaintext, id, err := k.decrypt(text, data)
+	if err != nil {
+		return "", false, err
+	}
+	if id == k.ActiveKeyId() {
+		return text, false, nil
+	}
+	ciphertext, err := k.Encrypt(plaintext, data...)
+	if err != nil {
+		return "", false, err
+	}
+	return ciphertext, true, nil
+}
+
+func (k *Keyring) decrypt(text string, data []string) (string, string, error) {
+	envelope := []byte(Base64Decode(text))
+	if len(envelope) < 2 {
+		return "", "", ErrAeadEnvelope
+	}
+	switch envelope[0] {
+	case aeadEnvelopeV1:
+		k.mutex.RLock()
+		keys := make([]KeyringKey, 0, len(k.order))
+		for _, id := range k.order {
+			if key := k.keys[id]; key.Status != KeyStatusRetired {
+				keys = append(keys, key)
+			}
+		}
+		k.mutex.RUnlock()
+		for _, key := range keys {
+			plaintext, err := openEnvelope(envelope, 2, []byte(Base64Decode(key.Key)), data)
+			if err == nil {
+				return plaintext, key.Id, nil
+			}
+		}
+		return "", "", ErrAeadAuthFailed
+	case aeadEnvelopeV2:
+		if len(envelope) < 3 || len(envelope) < 3+int(envelope[2]) {
+			return "", "", ErrAeadEnvelope
+		}
+		offset := 3 + int(envelope[2])
+		id := string(envelope[3:offset])
+		k.mutex.RLock()
+		key, ok := k.keys[id]
+		k.mutex.RUnlock()
+		if !ok {
+			return "", "", ErrKeyringUnknownKey
+		}
+		if key.Status == KeyStatusRetired {
+			return "", "", ErrKeyringRetiredKey
+		}
+		plaintext, err := openEnvelope(envelope, offset, []byte(Base64Decode(key.Key)), data)
+		return plaintext, id, err
+	}
+	return "", "", ErrAeadEnvelope
+}
@@ -0,0 +1,254 @@
+package iris_extend_helper
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type leaseContextKey struct{}
+
+var ErrLockNotHeld = errors.New("lock is not held by this owner")
+
+type Lease struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Token     int64     `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Locker interface {
+	Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (*Lease, bool, error)
+	Release(ctx context.Context, lease *Lease) error
+	Extend(ctx context.Context, lease *Lease, ttl time.Duration) error
+}
+
+func LockOwner() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), NormalizeId(Id())[:8])
+}
+
+func LeaseFromContext(ctx context.Context) (*Lease, bool) {
+	lease, ok := ctx.Value(leaseContextKey{}).(*Lease)
+	return lease, ok
+}
+
+func ContextWithLease(ctx context.Context, lease *Lease) context.Context {
+	return context.WithValue(ctx, leaseContextKey{}, lease)
+}
+
+type FileLocker struct {
+	Dir   string
+	mutex sync.Mutex
+}
+
+func NewFileLocker(dir string) (*FileLocker, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileLocker{Dir: dir}, nil
+}
+
+func (l *FileLocker) Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (*Lease, bool, error) {
+	var lease *Lease
+	acquired := false
+	err := l.update(ctx, name, func(current *Lease) (*Lease, error) {
+		now := time.Now()
+		if current.Owner != "" && current.Owner != owner && now.Before(current.ExpiresAt) {
+			return nil, nil
+		}
+		lease = &Lease{Name: name, Owner: owner, Token: current.Token + 1, ExpiresAt: now.Add(ttl)}
+		acquired = true
+		return lease, nil
+	})
+	return lease, acquired, err
+}
+
+func (l *FileLocker) Release(ctx context.Context, lease *Lease) error {
+	return l.update(ctx, lease.Name, func(current *Lease) (*Lease, error) {
+		if current.Owner != lease.Owner || current.Token != lease.Token {
+			return nil, ErrLockNotHeld
+		}
+		released := *current
+		released.Owner = ""
+		released.ExpiresAt = time.Time{}
+		return &released, nil
+	})
+}
+
+func (l *FileLocker) Extend(ctx context.Context, lease *Lease, ttl time.Duration) error {
+	return l.update(ctx, lease.Name, func(current *Lease) (*Lease, error) {
+		if current.Owner != lease.Owner || current.Token != lease.Token || time.Now().After(current.ExpiresAt) {
+			return nil, ErrLockNotHeld
+		}
+		extended := *current
+		extended.ExpiresAt = time.Now().Add(ttl)
+		return &extended, nil
+	})
+}
+
+func (l *FileLocker) update(ctx context.Context, name string, fn func(*Lease) (*Lease, error)) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	path := filepath.Join(l.Dir, NormalizeName(name)+".lease")
+	guard := path + ".guard"
+	for {
+		file, err := os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if info, err := os.Stat(guard); err == nil && time.Since(info.ModTime()) > 10*time.Second {
+			os.Remove(guard)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer os.Remove(guard)
+	current := &Lease{Name: name}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, current); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	next, err := fn(current)
+	if err != nil || next == nil {
+		return err
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	if err := ioutil.WriteFile(temp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+type SQLLocker struct {
+	DB          *sql.DB
+	Table       string
+	Placeholder string
+}
+
+func NewSQLLocker(db *sql.DB, table string, placeholder string) *SQLLocker {
+	if table == "" {
+		table = "scheduler_locks"
+	}
+	if placeholder == "" {
+		placeholder = "?"
+	}
+	return &SQLLocker{DB: db, Table: table, Placeholder: placeholder}
+}
+
+func (l *SQLLocker) EnsureTable(ctx context.Context) error {
+	query := "CREATE TABLE IF NOT EXISTS " + l.Table + " (" +
+		"name VARCHAR(255) PRIMARY KEY, owner VARCHAR(255) NOT NULL, " +
+		"token BIGINT NOT NULL, expires_at BIGINT NOT NULL)"
+	_, err := l.DB.ExecContext(ctx, query)
+	return err
+}
+
+func (l *SQLLocker) Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (*Lease, bool, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+	update := l.query("UPDATE " + l.Table + " SET owner = ?, token = token + 1, expires_at = ? " +
+		"WHERE name = ? AND (expires_at < ? OR owner = ?)")
+	result, err := tx.ExecContext(ctx, update, owner, expiresAt.UnixNano(), name, now.UnixNano(), owner)
+	if err != nil {
+		return nil, false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	if affected == 0 {
+		insert := l.query("INSERT INTO " + l.Table + " (name, owner, token, expires_at) VALUES (?, ?, 1, ?)")
+		if _, err := tx.ExecContext(ctx, insert, name, owner, expiresAt.UnixNano()); err != nil {
+			if isUniqueViolation(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+	}
+	lease := &Lease{Name: name, Owner: owner, ExpiresAt: expiresAt}
+	query := l.query("SELECT token FROM " + l.Table + " WHERE name = ? AND owner = ?")
+	if err := tx.QueryRowContext(ctx, query, name, owner).Scan(&lease.Token); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return lease, true, nil
+}
+
+func (l *SQLLocker) Release(ctx context.Context, lease *Lease) error {
+	query := l.query("UPDATE " + l.Table + " SET owner = '', expires_at = 0 WHERE name = ? AND owner = ? AND token = ?")
+	result, err := l.DB.ExecContext(ctx, query, lease.Name, lease.Owner, lease.Token)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (l *SQLLocker) Extend(ctx context.Context, lease *Lease, ttl time.Duration) error {
+	now := time.Now()
+	query := l.query("UPDATE " + l.Table + " SET expires_at = ? WHERE name = ? AND owner = ? AND token = ? AND expires_at >= ?")
+	result, err := l.DB.ExecContext(ctx, query, now.Add(ttl).UnixNano(), lease.Name, lease.Owner, lease.Token, now.UnixNano())
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// isUniqueViolation recognizes the duplicate key errors of the common SQL
+// drivers, which report a lost race to insert the same lock row.
+func isUniqueViolation(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "unique") || strings.Contains(message, "duplicate")
+}
+
+func (l *SQLLocker) query(str string) string {
+	if l.Placeholder == "?" {
+		return str
+	}
+	parts := strings.Split(str, "?")
+	for index := 1; index < len(parts); index++ {
+		parts[index] = l.Placeholder + strconv.Itoa(index) + parts[index]
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,78 @@
+package iris_extend_helper
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kataras/iris/v12"
+	"github.com/pelletier/go-toml"
+)
+
+const ProblemErrorKey = "problem-error"
+
+func NewErrorProblem(ctx iris.Context, err error, config *toml.Tree) iris.Problem {
+	status := ctx.GetStatusCode()
+	if err != nil {
+		status = ErrorStatus(err, status)
+	}
+	if status < 400 {
+		status = iris.StatusInternalServerError
+	}
+	problem := iris.NewProblem()
+	for key, value := range ErrorFields(err) {
+		problem.Key(key, value)
+	}
+	problemType := "about:blank"
+	code := ErrorCode(err)
+	if base := GetString(config, "problem-type-base"); base != "" && code != "" {
+		problemType = strings.TrimSuffix(base, "/") + "/" + code
+	}
+	problem.Type(problemType)
+	problem.Title(http.StatusText(status))
+	problem.Status(status)
+	problem.Instance(ctx.Request().URL.Path)
+	if code != "" {
+		problem.Key("code", code)
+	}
+	if err != nil {
+		if GetBool(config, "production") {
+			problem.Detail(ErrorMessage(err))
+		} else {
+			source, message, ok := ErrorSource(err)
+			problem.Detail(message)
+			if ok {
+				problem.Key("source", source)
+				problem.Key("stack", ErrorFrames(err))
+			}
+		}
+	}
+	return problem
+}
+
+func WriteProblem(ctx iris.Context, err error, config *toml.Tree) {
+	ctx.Problem(NewErrorProblem(ctx, err, config))
+}
+
+func AbortWithError(ctx iris.Context, err error) {
+	ctx.Values().Set(ProblemErrorKey, err)
+	ctx.StatusCode(ErrorStatus(err, iris.StatusInternalServerError))
+	ctx.StopExecution()
+}
+
+func ProblemHandler(config *toml.Tree) iris.Handler {
+	return func(ctx iris.Context) {
+		err, _ := ctx.Values().Get(ProblemErrorKey).(error)
+		WriteProblem(ctx, err, config)
+	}
+}
+
+func RegisterProblemHandlers(app *iris.Application, config *toml.Tree, codes ...int) {
+	handler := ProblemHandler(config)
+	if len(codes) == 0 {
+		app.OnAnyErrorCode(handler)
+		return
+	}
+	for _, code := range codes {
+		app.OnErrorCode(code, handler)
+	}
+}
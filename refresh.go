@@ -0,0 +1,282 @@
+package iris_extend_helper
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+type RevocationStore interface {
+	Revoke(id string, expiresAt time.Time) error
+	IsRevoked(id string) (bool, error)
+	UseOnce(id string, expiresAt time.Time) (bool, error)
+}
+
+// revocationPurgeInterval bounds how often expired entries are swept, so
+// that Revoke and UseOnce stay O(1) on busy stores. Entries that expired
+// before the next sweep are ignored by UseOnce.
+const revocationPurgeInterval = 60
+
+type MemoryRevocationStore struct {
+	revoked map[string]int64
+	used    map[string]int64
+	purged  int64
+	mutex   sync.Mutex
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked: make(map[string]int64),
+		used:    make(map[string]int64),
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(id string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.purge()
+	s.revoked[id] = expiresAt.Unix()
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.revoked[id]
+	return ok, nil
+}
+
+func (s *MemoryRevocationStore) UseOnce(id string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.purge()
+	if expiry, ok := s.used[id]; ok && expiry >= time.Now().Unix() {
+		return false, nil
+	}
+	s.used[id] = expiresAt.Unix()
+	return true, nil
+}
+
+func (s *MemoryRevocationStore) purge() {
+	now := time.Now().Unix()
+	if now-s.purged < revocationPurgeInterval {
+		return
+	}
+	s.purged = now
+	for id, expiry := range s.revoked {
+		if expiry < now {
+			delete(s.revoked, id)
+		}
+	}
+	for id, expiry := range s.used {
+		if expiry < now {
+			delete(s.used, id)
+		}
+	}
+}
+
+type FileRevocationStore struct {
+	MemoryRevocationStore
+	path string
+}
+
+type revocationFile struct {
+	Revoked map[string]int64 `json:"revoked"`
+	Used    map[string]int64 `json:"used"`
+}
+
+func NewFileRevocationStore(path string) (*FileRevocationStore, error) {
+	s := &FileRevocationStore{path: path}
+	s.revoked = make(map[string]int64)
+	s.used = make(map[string]int64)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	content := revocationFile{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	if content.Revoked != nil {
+		s.revoked = content.Revoked
+	}
+	if content.Used != nil {
+		s.used = content.Used
+	}
+	return s, nil
+}
+
+func (s *FileRevocationStore) Revoke(id string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.purge()
+	s.revoked[id] = expiresAt.Unix()
+	return s.save()
+}
+
+func (s *FileRevocationStore) UseOnce(id string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.purge()
+	if expiry, ok := s.used[id]; ok && expiry >= time.Now().Unix() {
+		return false, nil
+	}
+	s.used[id] = expiresAt.Unix()
+	return true, s.save()
+}
+
+func (s *FileRevocationStore) save() error {
+	data, err := json.Marshal(revocationFile{Revoked: s.revoked, Used: s.used})
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), s.path)
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+}
+
+type TokenIssuer struct {
+	config *toml.Tree
+	store  RevocationStore
+	key    []string
+}
+
+func NewTokenIssuer(config *toml.Tree, store RevocationStore, key ...string) *TokenIssuer {
+	return &TokenIssuer{config: config, store: store, key: key}
+}
+
+func (ti *TokenIssuer) Issue(claims jwt.MapClaims) (TokenPair, error) {
+	return ti.issue(claims, Id())
+}
+
+func (ti *TokenIssuer) Refresh(refreshToken string) (TokenPair, error) {
+	claims, ok := ti.parseRefreshToken(refreshToken)
+	if !ok || claims["typ"] != "refresh" {
+		return TokenPair{}, ErrRefreshTokenInvalid
+	}
+	id := ParseString(claims["jti"])
+	family := ParseString(claims["fam"])
+	expiresAt := time.Unix(ParseInt64(claims["exp"]), 0)
+	for _, name := range []string{family, id} {
+		if revoked, err := ti.store.IsRevoked(name); err != nil {
+			return TokenPair{}, err
+		} else if revoked {
+			return TokenPair{}, ErrTokenRevoked
+		}
+	}
+	fresh, err := ti.store.UseOnce(id, expiresAt)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !fresh {
+		if err := ti.RevokeFamily(family); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrRefreshTokenReused
+	}
+	for _, name := range []string{"typ", "jti", "fam", "exp", "iat", "nbf"} {
+		delete(claims, name)
+	}
+	return ti.issue(claims, family)
+}
+
+func (ti *TokenIssuer) Revoke(claims jwt.MapClaims) error {
+	expiresAt := time.Unix(ParseInt64(claims["exp"]), 0)
+	if _, ok := claims["exp"]; !ok {
+		expiresAt = time.Now().Add(GetDuration(ti.config, "refresh-max-age", 720*time.Hour))
+	}
+	return ti.store.Revoke(ParseString(claims["jti"]), expiresAt)
+}
+
+func (ti *TokenIssuer) RevokeFamily(family string) error {
+	maxAge := GetDuration(ti.config, "refresh-max-age", 720*time.Hour)
+	return ti.store.Revoke(family, time.Now().Add(maxAge))
+}
+
+func (ti *TokenIssuer) issue(claims jwt.MapClaims, family string) (TokenPair, error) {
+	access := jwt.MapClaims{}
+	refresh := jwt.MapClaims{}
+	for key, value := range claims {
+		access[key] = value
+		refresh[key] = value
+	}
+	access["jti"] = Id()
+	access["fam"] = family
+	refresh["jti"] = Id()
+	refresh["fam"] = family
+	refresh["typ"] = "refresh"
+	refresh["iat"] = time.Now().Unix()
+	refresh["exp"] = time.Now().Add(GetDuration(ti.config, "refresh-max-age", 720*time.Hour)).Unix()
+	pair := TokenPair{
+		AccessToken: SignClaims(access, ti.config, ti.key...),
+		TokenType:   "Bearer",
+	}
+	if exp, ok := access["exp"]; ok {
+		pair.ExpiresIn = ParseInt64(exp) - time.Now().Unix()
+	}
+	if GetString(ti.config, "refresh-token-format", "jwt") == "opaque" {
+		token, err := AeadEncrypt(string(GetJSON(refresh)), GetString(ti.config, "refresh-key"), AeadAesGcm, "refresh")
+		if err != nil {
+			return TokenPair{}, err
+		}
+		pair.RefreshToken = token
+	} else {
+		pair.RefreshToken = SignClaims(refresh, ti.config, ti.key...)
+	}
+	if pair.AccessToken == "" || pair.RefreshToken == "" {
+		return TokenPair{}, errors.New("failed to sign tokens")
+	}
+	return pair, nil
+}
+
+func (ti *TokenIssuer) parseRefreshToken(str string) (jwt.MapClaims, bool) {
+	if GetString(ti.config, "refresh-token-format", "jwt") == "opaque" {
+		text, err := AeadDecrypt(str, GetString(ti.config, "refresh-key"), "refresh")
+		if err != nil {
+			return jwt.MapClaims{}, false
+		}
+		claims := jwt.MapClaims(ParseMap(text))
+		if time.Now().Unix() > ParseInt64(claims["exp"]) {
+			return jwt.MapClaims{}, false
+		}
+		return claims, true
+	}
+	key := ""
+	if len(ti.key) > 0 && !GetBool(ti.config, "use-global-key") {
+		key = ti.key[0]
+	}
+	return ParseToken(str, key, ti.config)
+}
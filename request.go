@@ -1,17 +1,14 @@
 package iris_extend_helper
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha1"
+	"context"
 	"crypto/tls"
-	"encoding/base64"
-	"io/ioutil"
+	"errors"
 	"log"
 	"mime"
 	"net/http"
 	"net/url"
-	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,7 +20,8 @@ import (
 
 var client *http.Client = &http.Client{
 	Transport: &http.Transport{
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     &tls.Config{MinVersion: tls.VersionTLS12},
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 10,
 	},
@@ -52,43 +50,37 @@ func ParseURL(rawurl string) (*url.URL, bool) {
 	return u, false
 }
 
+// AliyunRequestSign signs a legacy request map. With `aliyun_nonce` set,
+// a random x-<product>-nonce header is added and covered by the signature,
+// as SignatureVerification requires by default.
 func AliyunRequestSign(request iris.Map) iris.Map {
 	method := ParseString(request["method"], "GET")
-	content := method + "\n"
 	headers := ParseMap(request["headers"])
-	if contentMD5, ok := headers["Content-MD5"]; ok {
-		content += ParseString(contentMD5) + "\n"
-	}
 	contentType := ParseString(headers["Content-Type"], "application/json")
 	date := time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")
-	content += contentType + "\n" + date + "\n"
-
 	name := ParseString(request["aliyun_product_name"])
-	headerPrefix := "x-" + strings.ToLower(name) + "-"
-	customHeaders := []string{}
-	for key := range headers {
-		header := strings.ToLower(key)
-		if strings.HasPrefix(header, headerPrefix) {
-			customHeaders = append(customHeaders, header)
-		}
+	if ParseBool(request["aliyun_nonce"]) {
+		headers["X-"+strings.ToLower(name)+"-Nonce"] = Id()
 	}
-	sort.Strings(customHeaders)
-	for _, header := range customHeaders {
-		content += header + ":" + ParseString(headers[header]) + "\n"
+	header := http.Header{}
+	for key, value := range headers {
+		header.Set(key, ParseString(value))
 	}
+	header.Set("Content-Type", contentType)
+	header.Set("Date", date)
 
+	path := ""
 	rawurl := ParseString(request["url"])
 	if u, err := url.Parse(rawurl); err != nil {
 		log.Println(err)
 	} else {
-		content += u.Path
+		path = u.Path
 	}
 
 	accessId := ParseString(request["aliyun_access_id"])
 	accessKey := ParseString(request["aliyun_access_key"])
-	mac := hmac.New(sha1.New, []byte(accessKey))
-	mac.Write([]byte(content))
-	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	content := AliyunStringToSign(method, header, name, path)
+	signature := AliyunSignature(content, accessKey)
 	headers["Content-Type"] = contentType
 	headers["Date"] = date
 	headers["Authorization"] = strings.ToUpper(name) + " " + accessId + ":" + signature
@@ -97,116 +89,42 @@ func AliyunRequestSign(request iris.Map) iris.Map {
 }
 
 func GetData(request iris.Map) ([]byte, bool) {
-	rawurl := ParseString(request["url"])
-	u, err := url.Parse(rawurl)
-	if err != nil {
-		log.Println(err)
-	}
-	if u.Scheme == "" {
-		return make([]byte, 0), false
-	}
-	if params, ok := request["url_params"]; ok {
-		params := ParseMap(params)
-		values := u.Query()
-		for key, value := range params {
-			values.Set(key, ParseString(value))
-		}
-		u.RawQuery = values.Encode()
-	}
-	header := http.Header{}
-	if headers, ok := request["headers"]; ok {
-		headers := ParseMap(headers)
-		for key, value := range headers {
-			header.Set(key, ParseString(value))
-		}
-	}
-	req, err := http.NewRequest("GET", u.String(), nil)
-	if err != nil {
-		log.Println(err)
-		return make([]byte, 0), false
-	}
-	req.Header = header
-
-	res, err := client.Do(req)
-	if err != nil {
-		log.Println(err)
-		return make([]byte, 0), false
-	}
-	defer res.Body.Close()
-	content, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.Println(err)
-	} else {
-		code := res.StatusCode
-		return content, code >= 200 && code < 400
-	}
-	return make([]byte, 0), false
+	return legacyResult(defaultClient.Do(context.Background(), NewRequest(http.MethodGet, request)))
 }
 
 func PostData(request iris.Map) ([]byte, bool) {
-	rawurl := ParseString(request["url"])
-	u, err := url.Parse(rawurl)
-	if err != nil {
-		log.Println(err)
-	}
-	if u.Scheme == "" {
-		return make([]byte, 0), false
-	}
-	if params, ok := request["url_params"]; ok {
-		params := ParseMap(params)
-		values := u.Query()
-		for key, value := range params {
-			values.Set(key, ParseString(value))
-		}
-		u.RawQuery = values.Encode()
-	}
-	header := http.Header{}
-	header.Set("Content-Type", "application/x-www-form-urlencoded")
-	if headers, ok := request["headers"]; ok {
-		headers := ParseMap(headers)
-		for key, value := range headers {
-			header.Set(key, ParseString(value))
+	return legacyResult(defaultClient.Do(context.Background(), NewRequest(http.MethodPost, request)))
+}
+
+func BackoffDelay(strategy string, initial time.Duration, attempt int) time.Duration {
+	if initial < time.Millisecond {
+		initial = time.Millisecond
+	}
+	switch strategy {
+	case "linear":
+		return time.Duration(attempt+1) * initial
+	case "exponential":
+		if attempt > 30 {
+			attempt = 30
 		}
-	}
-	data := make([]byte, 0)
-	if body, ok := request["body"]; ok {
-		switch header.Get("Content-Type") {
-		case "application/x-www-form-urlencoded":
-			body := ParseMap(body)
-			values := url.Values{}
-			for key, value := range body {
-				values.Set(key, ParseString(value))
-			}
-			data = []byte(values.Encode())
-		default:
-			data = []byte(ParseString(body))
+		if attempt > 0 {
+			return (1 << uint(attempt-1)) * initial
 		}
 	}
-	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(data))
-	if err != nil {
-		log.Println(err)
-		return make([]byte, 0), false
-	}
-	req.Header = header
-
-	res, err := client.Do(req)
-	if err != nil {
-		log.Println(err)
-		return make([]byte, 0), false
-	}
-	defer res.Body.Close()
-	content, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.Println(err)
-	} else {
-		code := res.StatusCode
-		return content, code >= 200 && code < 400
-	}
-	return make([]byte, 0), false
+	return initial
 }
 
+var retryMutex sync.Mutex
+
 func RetryGetData(request iris.Map, config *toml.Tree) ([]byte, bool) {
-	mutex := new(sync.Mutex)
+	return retryData(http.MethodGet, request, config)
+}
+
+func RetryPostData(request iris.Map, config *toml.Tree) ([]byte, bool) {
+	return retryData(http.MethodPost, request, config)
+}
+
+func retryData(method string, request iris.Map, config *toml.Tree) ([]byte, bool) {
 	mode := GetString(config, "fail-mode", "failtry")
 	retries := GetInt(config, "max-retries")
 	if mode == "failfast" || retries == 0 {
@@ -215,96 +133,141 @@ func RetryGetData(request iris.Map, config *toml.Tree) ([]byte, bool) {
 	endpoints := GetStringArray(config, "service-endpoints")
 	strategy := GetString(config, "backoff-strategy")
 	duration := GetDuration(config, "initial-backoff")
-	if duration < time.Millisecond {
-		duration = time.Millisecond
+	breakers := GetBool(config, "circuit-breaker", true)
+	codes := ParseUint64Array(config.Get("retry-status-codes"), nil)
+	maxRetryAfter := GetDuration(config, "max-retry-after", time.Minute)
+	idempotencyKey := ""
+	if method == http.MethodPost {
+		if codes == nil {
+			codes = []uint64{429, 502, 503, 504}
+		}
+		if GetBool(config, "idempotency-key", true) {
+			idempotencyKey = Id()
+		}
+	}
+	wait := time.Duration(0)
+	var balancer *LoadBalancer
+	if len(endpoints) > 0 && mode == "failover" {
+		balancer = GetLoadBalancer(endpoints, config)
+		endpoints = balancer.Endpoints(ParseString(request["hash_key"]))
 	}
-	count := 0
-	ticks := 0
-	ticker := time.NewTicker(duration)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			ready := true
-			ticks += 1
-			if strategy == "linear" {
-				ready = ticks >= (count+1)*(count+2)/2
-			} else if strategy == "exponential" {
-				ready = ticks >= (1 << uint(count))
+	for count := 0; count < retries; count++ {
+		if delay := BackoffDelay(strategy, duration, count); delay > wait {
+			wait = delay
+		}
+		time.Sleep(wait)
+		wait = 0
+		endpoint := ParseString(request["url"])
+		candidates := []string{endpoint}
+		if length := len(endpoints); balancer != nil && length > 0 {
+			candidates = make([]string, 0, length)
+			for index := 0; index < length; index++ {
+				candidates = append(candidates, endpoints[(count+index)%length])
+			}
+		}
+		var breaker *CircuitBreaker
+		allowed := false
+		for _, candidate := range candidates {
+			if !breakers {
+				endpoint, allowed = candidate, true
+				break
+			}
+			breaker = GetCircuitBreaker(candidate, config)
+			if breaker.Allow() {
+				endpoint, allowed = candidate, true
+				break
+			}
+		}
+		if !allowed {
+			log.Println(method, endpoint, "circuit breaker is open")
+			return make([]byte, 0), false
+		}
+		request["url"] = endpoint
+		if balancer != nil {
+			balancer.Acquire(endpoint)
+		}
+		req := NewRequest(method, request)
+		if idempotencyKey != "" && req.Header.Get("Idempotency-Key") == "" {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		response, err := defaultClient.Do(context.Background(), req)
+		if breaker != nil {
+			breaker.Record(!breakerFailure(err))
+		}
+		if balancer != nil {
+			balancer.Release(endpoint, !breakerFailure(err))
+		}
+		if result, ok := legacyResult(response, err); ok {
+			if mode == "failover" {
+				retryMutex.Lock()
+				config.Set("service-url", endpoint)
+				retryMutex.Unlock()
 			}
-			if ready {
-				if count < retries {
-					length := len(endpoints)
-					if length > 0 && mode == "failover" {
-						request["url"] = endpoints[count%length]
-					}
-					if result, ok := GetData(request); ok {
-						if mode == "failover" {
-							mutex.Lock()
-							config.Set("service-url", request["url"])
-							mutex.Unlock()
-						}
-						return result, true
-					}
-					count += 1
-				} else {
+			return result, true
+		}
+		if !retryable(err, codes) {
+			return make([]byte, 0), false
+		}
+		if response != nil {
+			if delay, ok := RetryAfter(response.Header); ok {
+				if delay > maxRetryAfter {
+					log.Println(method, endpoint, "Retry-After exceeds", maxRetryAfter)
 					return make([]byte, 0), false
 				}
+				wait = delay
 			}
 		}
 	}
 	return make([]byte, 0), false
 }
 
-func RetryPostData(request iris.Map, config *toml.Tree) ([]byte, bool) {
-	mutex := new(sync.Mutex)
-	mode := GetString(config, "fail-mode", "failtry")
-	retries := GetInt(config, "max-retries")
-	if mode == "failfast" || retries == 0 {
-		return make([]byte, 0), false
+// RetryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date.
+func RetryAfter(header http.Header) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+		return time.Duration(seconds) * time.Second, true
 	}
-	endpoints := GetStringArray(config, "service-endpoints")
-	strategy := GetString(config, "backoff-strategy")
-	duration := GetDuration(config, "initial-backoff")
-	if duration < time.Millisecond {
-		duration = time.Millisecond
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
 	}
-	count := 0
-	ticks := 0
-	ticker := time.NewTicker(duration)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			ready := true
-			ticks += 1
-			if strategy == "linear" {
-				ready = ticks >= (count+1)*(count+2)/2
-			} else if strategy == "exponential" {
-				ready = ticks >= (1 << uint(count))
-			}
-			if ready {
-				if count < retries {
-					length := len(endpoints)
-					if length > 0 && mode == "failover" {
-						request["url"] = endpoints[count%length]
-					}
-					if result, ok := PostData(request); ok {
-						if mode == "failover" {
-							mutex.Lock()
-							config.Set("service-url", request["url"])
-							mutex.Unlock()
-						}
-						return result, true
-					}
-					count += 1
-				} else {
-					return make([]byte, 0), false
-				}
+	return 0, false
+}
+
+// retryable reports whether a failed attempt may be retried. Connection
+// errors are always retried; status errors only for the given codes, or
+// for any code when codes is nil. Bodies that failed to encode and
+// responses over MaxBodySize are never retried.
+func retryable(err error, codes []uint64) bool {
+	var requestError *RequestError
+	if !errors.As(err, &requestError) {
+		return true
+	}
+	switch requestError.Kind {
+	case ErrEncode, ErrBodyTooLarge:
+		return false
+	case ErrStatus:
+		if codes == nil {
+			return true
+		}
+		for _, code := range codes {
+			if int(code) == requestError.StatusCode {
+				return true
 			}
 		}
+		return false
 	}
-	return make([]byte, 0), false
+	return true
 }
 
 func CheckResponseResult(result []byte) ([]byte, bool) {
@@ -1,81 +1,428 @@
 package iris_extend_helper
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kataras/iris/v12"
 	"github.com/robfig/cron/v3"
 )
 
+var DefaultJobHistorySize = 20
+
+const (
+	OverlapAllow = "allow-concurrent"
+	OverlapSkip  = "skip-if-running"
+	OverlapQueue = "queue-one"
+)
+
 type Job struct {
-	Schedule string
-	Task     func()
+	Name            string
+	Schedule        string
+	Timezone        string
+	Calendar        *Calendar
+	Jitter          time.Duration
+	Anchor          time.Time
+	Overlap         string
+	Timeout         time.Duration
+	MaxRetries      int
+	BackoffStrategy string
+	InitialBackoff  time.Duration
+	Locker          Locker
+	LockTTL         time.Duration
+	Task            func()
+	Run             func(ctx context.Context) error
 }
 
-func RegisterScheduledTasks(app *iris.Application, jobs []Job) {
-	c := cron.New(cron.WithSeconds())
-	for _, job := range jobs {
-		schedule := job.Schedule
-		task := job.Task
-		if strings.Contains(schedule, " ") {
-			if _, ok := ParseSchedule(schedule); ok {
-				c.AddFunc(schedule, task)
+type JobError struct {
+	Name string
+	Err  error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("job %s: %v", e.Name, e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+type JobErrors []*JobError
+
+func (e JobErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+type IntervalSchedule struct {
+	Interval time.Duration
+	Jitter   time.Duration
+	Anchor   time.Time
+	origin   time.Time
+	mutex    sync.Mutex
+}
+
+func NewIntervalSchedule(interval time.Duration, jitter time.Duration, anchor time.Time) (*IntervalSchedule, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %v", interval)
+	}
+	if jitter < 0 || jitter >= interval {
+		return nil, fmt.Errorf("jitter must be between 0 and the interval, got %v", jitter)
+	}
+	return &IntervalSchedule{Interval: interval, Jitter: jitter, Anchor: anchor}, nil
+}
+
+// Next returns the first slot after t plus a random jitter. Slots are
+// counted from Anchor, or from the first call to Next when there is none,
+// so that the jitter of one run does not delay the following ones.
+func (s *IntervalSchedule) Next(t time.Time) time.Time {
+	anchor := s.Anchor
+	if anchor.IsZero() {
+		s.mutex.Lock()
+		if s.origin.IsZero() {
+			s.origin = t
+		}
+		anchor = s.origin
+		s.mutex.Unlock()
+	}
+	elapsed := t.Sub(anchor)
+	periods := elapsed / s.Interval
+	if elapsed >= 0 {
+		periods += 1
+	}
+	next := anchor.Add(periods * s.Interval)
+	if !next.After(t) {
+		next = next.Add(s.Interval)
+	}
+	if s.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.Jitter))))
+	}
+	return next
+}
+
+type JobRun struct {
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error,omitempty"`
+	Panic    bool          `json:"panic,omitempty"`
+}
+
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next"`
+	Running  int       `json:"running"`
+	Runs     []JobRun  `json:"runs"`
+}
+
+type scheduledJob struct {
+	job      Job
+	schedule cron.Schedule
+	entry    cron.EntryID
+	context  context.Context
+	owner    string
+	history  []JobRun
+	offset   int
+	running  int
+	pending  bool
+	mutex    sync.Mutex
+}
+
+type Scheduler struct {
+	cron   *cron.Cron
+	jobs   []*scheduledJob
+	cancel context.CancelFunc
+}
+
+func (j *scheduledJob) run() {
+	j.mutex.Lock()
+	if j.running > 0 {
+		switch j.job.Overlap {
+		case OverlapSkip:
+			j.mutex.Unlock()
+			log.Printf("job %s is still running, skipping", j.job.Name)
+			return
+		case OverlapQueue:
+			j.pending = true
+			j.mutex.Unlock()
+			return
+		}
+	}
+	j.running += 1
+	j.mutex.Unlock()
+	for {
+		if entry, ok := j.execute(); ok {
+			j.record(entry)
+		}
+		j.mutex.Lock()
+		if !j.pending || j.job.Overlap != OverlapQueue {
+			j.running -= 1
+			j.mutex.Unlock()
+			return
+		}
+		j.pending = false
+		j.mutex.Unlock()
+	}
+}
+
+func (j *scheduledJob) execute() (JobRun, bool) {
+	entry := JobRun{Start: time.Now()}
+	ctx := j.context
+	if j.job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.job.Timeout)
+		defer cancel()
+	}
+	if j.job.Locker != nil {
+		ttl := j.job.LockTTL
+		if ttl <= 0 {
+			ttl = j.job.Timeout + time.Minute
+		}
+		lease, ok, err := j.job.Locker.Acquire(ctx, j.job.Name, j.owner, ttl)
+		if err != nil {
+			log.Printf("job %s failed to acquire lock: %v", j.job.Name, err)
+			return entry, false
+		}
+		if !ok {
+			return entry, false
+		}
+		defer func() {
+			if err := j.job.Locker.Release(context.Background(), lease); err != nil {
+				log.Printf("job %s failed to release lock: %v", j.job.Name, err)
 			}
-		} else {
-			duration, err := time.ParseDuration(schedule)
-			if err != nil {
-				log.Println(err)
-			} else {
-				seconds := int(duration.Seconds())
-				if seconds == 1 {
-					c.AddFunc("* * * * * *", task)
-				} else if seconds >= 2 && seconds < 60 {
-					for i := 0; i < seconds; i++ {
-						expr := fmt.Sprintf("%d/%d * * * * *", i, seconds)
-						c.AddFunc(expr, task)
-					}
-				} else {
-					minutes := int(duration.Minutes())
-					if minutes == 1 {
-						for i := 0; i < 60; i++ {
-							expr := fmt.Sprintf("%d * * * * *", i)
-							c.AddFunc(expr, task)
-						}
-					} else if minutes >= 2 && minutes < 60 {
-						for i := 0; i < 60; i++ {
-							for j := 0; j < minutes; j++ {
-								expr := fmt.Sprintf("%d %d/%d * * * *", i, j, minutes)
-								c.AddFunc(expr, task)
-							}
-						}
-					} else {
-						hours := int(duration.Hours())
-						if hours == 1 {
-							for i := 0; i < 60; i++ {
-								for j := 0; j < 60; j++ {
-									expr := fmt.Sprintf("%d %d * * * *", i, j)
-									c.AddFunc(expr, task)
-								}
-							}
-						} else if hours >= 2 && hours < 60 {
-							for i := 0; i < 60; i++ {
-								for j := 0; j < 60; j++ {
-									for k := 0; k < hours; k++ {
-										expr := fmt.Sprintf("%d %d %d/%d * * *", i, j, k, hours)
-										c.AddFunc(expr, task)
-									}
-								}
-							}
-						}
-					}
+		}()
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ContextWithLease(ctx, lease))
+		defer cancel()
+		go j.heartbeat(ctx, cancel, lease, ttl)
+	}
+	for {
+		entry.Attempts += 1
+		err := j.attempt(ctx, &entry)
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			entry.Error = ""
+			break
+		}
+		entry.Error = err.Error()
+		log.Printf("job %s failed: %v", j.job.Name, err)
+		if entry.Attempts > j.job.MaxRetries || ctx.Err() != nil {
+			break
+		}
+		delay := BackoffDelay(j.job.BackoffStrategy, j.job.InitialBackoff, entry.Attempts-1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	entry.End = time.Now()
+	entry.Duration = entry.End.Sub(entry.Start)
+	return entry, true
+}
+
+// heartbeat extends the lease every third of its TTL while the job runs
+// and cancels the job if the lease is lost, so that another replica that
+// takes over the lock never runs concurrently with this one.
+func (j *scheduledJob) heartbeat(ctx context.Context, cancel context.CancelFunc, lease *Lease, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.job.Locker.Extend(ctx, lease, ttl); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("job %s failed to extend lock: %v", j.job.Name, err)
+				if errors.Is(err, ErrLockNotHeld) {
+					cancel()
+					return
 				}
 			}
 		}
 	}
+}
+
+func (j *scheduledJob) attempt(ctx context.Context, entry *JobRun) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			entry.Panic = true
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if j.job.Run != nil {
+		return j.job.Run(ctx)
+	}
+	j.job.Task()
+	return nil
+}
+
+func (j *scheduledJob) record(entry JobRun) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	size := DefaultJobHistorySize
+	if size <= 0 {
+		return
+	}
+	if len(j.history) < size {
+		j.history = append(j.history, entry)
+	} else {
+		j.history[j.offset] = entry
+		j.offset = (j.offset + 1) % len(j.history)
+	}
+}
+
+func (j *scheduledJob) status() JobStatus {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	status := JobStatus{
+		Name:     j.job.Name,
+		Schedule: j.job.Schedule,
+		Running:  j.running,
+		Runs:     make([]JobRun, 0, len(j.history)),
+	}
+	for index := range j.history {
+		status.Runs = append(status.Runs, j.history[(j.offset+index)%len(j.history)])
+	}
+	return status
+}
+
+func (s *Scheduler) Jobs() []JobStatus {
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status := job.status()
+		status.Next = s.cron.Entry(job.entry).Next
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (s *Scheduler) Stop(ctx context.Context) error {
+	done := s.cron.Stop()
+	select {
+	case <-done.Done():
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return ctx.Err()
+	}
+}
+
+func RegisterSchedulerRoute(app *iris.Application, path string, scheduler *Scheduler) {
+	app.Get(path, func(ctx iris.Context) {
+		ctx.JSON(iris.Map{"jobs": scheduler.Jobs()})
+	})
+}
+
+func RegisterScheduledTasks(app *iris.Application, jobs []Job) (*Scheduler, error) {
+	c := cron.New(cron.WithSeconds())
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler := &Scheduler{cron: c, cancel: cancel}
+	owner := LockOwner()
+	errs := JobErrors{}
+	for index, job := range jobs {
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("job-%d", index)
+		}
+		schedule, err := ParseJobSchedule(job)
+		if err == nil {
+			err = validateJob(job)
+		}
+		if err != nil {
+			errs = append(errs, &JobError{Name: job.Name, Err: err})
+			continue
+		}
+		scheduler.jobs = append(scheduler.jobs, &scheduledJob{job: job, schedule: schedule, context: ctx, owner: owner})
+	}
+	if len(errs) > 0 {
+		cancel()
+		return nil, errs
+	}
+	for _, job := range scheduler.jobs {
+		job.entry = c.Schedule(job.schedule, cron.FuncJob(job.run))
+	}
 	c.Start()
+	return scheduler, nil
+}
+
+func validateJob(job Job) error {
+	if job.Task == nil && job.Run == nil {
+		return errors.New("job has no task")
+	}
+	switch job.Overlap {
+	case "", OverlapAllow, OverlapSkip, OverlapQueue:
+	default:
+		return fmt.Errorf("invalid overlap policy %q", job.Overlap)
+	}
+	if job.Timeout < 0 || job.MaxRetries < 0 {
+		return errors.New("timeout and max retries must not be negative")
+	}
+	return nil
+}
+
+func ParseJobSchedule(job Job) (cron.Schedule, error) {
+	schedule, err := parseJobSchedule(job)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := schedule.(*MonthlyBusinessDaySchedule); !ok && job.Calendar != nil {
+		return &BusinessDaySchedule{Schedule: schedule, Calendar: job.Calendar}, nil
+	}
+	return schedule, nil
+}
+
+func parseJobSchedule(job Job) (cron.Schedule, error) {
+	expr := strings.TrimSpace(job.Schedule)
+	if strings.HasPrefix(expr, "@every ") || !strings.ContainsAny(expr, " @") {
+		duration, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, err
+		}
+		return NewIntervalSchedule(duration, job.Jitter, job.Anchor)
+	}
+	if job.Jitter != 0 || !job.Anchor.IsZero() {
+		return nil, errors.New("jitter and anchor only apply to interval schedules")
+	}
+	if isBusinessDayDescriptor(expr) {
+		calendar := job.Calendar
+		if calendar == nil {
+			location, err := loadLocation(job.Timezone)
+			if err != nil {
+				return nil, err
+			}
+			calendar = NewCalendar(location)
+		}
+		return ParseBusinessDaySchedule(expr, calendar)
+	}
+	if job.Timezone != "" {
+		if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+			return nil, errors.New("timezone conflicts with the CRON_TZ prefix of the schedule")
+		}
+		if _, err := time.LoadLocation(job.Timezone); err != nil {
+			return nil, err
+		}
+		expr = "CRON_TZ=" + job.Timezone + " " + expr
+	}
+	scheduler := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	return scheduler.Parse(expr)
 }
 
 func ParseSchedule(expr string) (cron.Schedule, bool) {
@@ -2,6 +2,7 @@ package iris_extend_helper
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
@@ -9,12 +10,14 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/pem"
+	"errors"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pelletier/go-toml"
+	"golang.org/x/crypto/chacha20poly1305"
 
 	"io"
 	"log"
@@ -105,6 +108,104 @@ func AesDecrypt(text string, key string) (string, bool) {
 	return "", false
 }
 
+const (
+	AeadAesGcm           = "AES-GCM"
+	AeadChaCha20Poly1305 = "CHACHA20-POLY1305"
+)
+
+const (
+	aeadEnvelopeV1 byte = 1
+	aeadEnvelopeV2 byte = 2
+)
+
+var aeadAlgorithms = map[string]byte{
+	AeadAesGcm:           1,
+	AeadChaCha20Poly1305: 2,
+}
+
+var (
+	ErrAeadAlgorithm  = errors.New("aead: unsupported algorithm")
+	ErrAeadEnvelope   = errors.New("aead: malformed ciphertext envelope")
+	ErrAeadAuthFailed = errors.New("aead: message authentication failed")
+)
+
+func newAead(algorithm byte, key []byte) (cipher.AEAD, error) {
+	switch algorithm {
+	case aeadAlgorithms[AeadAesGcm]:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case aeadAlgorithms[AeadChaCha20Poly1305]:
+		return chacha20poly1305.New(key)
+	}
+	return nil, ErrAeadAlgorithm
+}
+
+// additionalData binds the envelope header and each data element, prefixed
+// with its 4 byte big-endian length so that ("ab", "c") and ("a", "bc")
+// authenticate differently.
+func additionalData(header []byte, data []string) []byte {
+	additional := append([]byte{}, header...)
+	length := make([]byte, 4)
+	for _, item := range data {
+		binary.BigEndian.PutUint32(length, uint32(len(item)))
+		additional = append(append(additional, length...), item...)
+	}
+	return additional
+}
+
+func sealEnvelope(header []byte, key []byte, plaintext []byte, data []string) (string, error) {
+	aead, err := newAead(header[1], key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	additional := additionalData(header, data)
+	envelope := append(append(header, nonce...), aead.Seal(nil, nonce, plaintext, additional)...)
+	return Base64Encode(string(envelope)), nil
+}
+
+func openEnvelope(envelope []byte, offset int, key []byte, data []string) (string, error) {
+	aead, err := newAead(envelope[1], key)
+	if err != nil {
+		return "", err
+	}
+	size := aead.NonceSize()
+	if len(envelope) < offset+size+aead.Overhead() {
+		return "", ErrAeadEnvelope
+	}
+	header := envelope[:offset]
+	nonce := envelope[offset : offset+size]
+	additional := additionalData(header, data)
+	plaintext, err := aead.Open(nil, nonce, envelope[offset+size:], additional)
+	if err != nil {
+		return "", ErrAeadAuthFailed
+	}
+	return string(plaintext), nil
+}
+
+func AeadEncrypt(text string, key string, algorithm string, data ...string) (string, error) {
+	id, ok := aeadAlgorithms[strings.ToUpper(algorithm)]
+	if !ok {
+		return "", ErrAeadAlgorithm
+	}
+	header := []byte{aeadEnvelopeV1, id}
+	return sealEnvelope(header, []byte(Base64Decode(key)), []byte(text), data)
+}
+
+func AeadDecrypt(text string, key string, data ...string) (string, error) {
+	envelope := []byte(Base64Decode(text))
+	if len(envelope) < 2 || envelope[0] != aeadEnvelopeV1 {
+		return "", ErrAeadEnvelope
+	}
+	return openEnvelope(envelope, 2, []byte(Base64Decode(key)), data)
+}
+
 func PublicKeyEncodeString(key *rsa.PublicKey) string {
 	pubkey := pem.EncodeToMemory(&pem.Block{
 		Type:  "RSA PUBLIC KEY",
@@ -145,6 +246,57 @@ func PrivateKeyDecodeString(str string) *rsa.PrivateKey {
 	return nil
 }
 
+func SigningKeyDecodeString(str string) crypto.PrivateKey {
+	block, _ := pem.Decode([]byte(str))
+	if block != nil {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			if key := PrivateKeyDecodeString(str); key != nil {
+				return key
+			}
+		case "EC PRIVATE KEY":
+			key, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				log.Println(err)
+			} else {
+				return key
+			}
+		default:
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				log.Println(err)
+			} else {
+				return key
+			}
+		}
+	}
+	return nil
+}
+
+func VerifyingKeyDecodeString(str string) crypto.PublicKey {
+	block, _ := pem.Decode([]byte(str))
+	if block != nil {
+		switch {
+		case block.Type == "RSA PUBLIC KEY":
+			if key := PublicKeyDecodeString(str); key != nil {
+				return key
+			}
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if key, ok := SigningKeyDecodeString(str).(crypto.Signer); ok {
+				return key.Public()
+			}
+		default:
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				log.Println(err)
+			} else {
+				return key
+			}
+		}
+	}
+	return nil
+}
+
 func RsaEncrypt(text string, key *rsa.PublicKey) (string, bool) {
 	hash := sha256.New()
 	rng := rand.Reader
@@ -190,11 +342,25 @@ func CheckIPWhitelist(whitelist []string, addr string) bool {
 	return false
 }
 
+// Integrity digests JSON objects with the jsoniter encoding used so far.
+// Set the canonicalization to jcs to digest them with CanonicalJSON
+// instead, which does not depend on the encoder.
 func Integrity(value interface{}, config *toml.Tree) string {
 	integrity := strings.ToLower(GetString(config, "integrity", "SHA384"))
+	content := integrityContent(value, GetString(config, "canonicalization", "legacy"))
+	bytes, ok := integrityDigest(integrity, content)
+	if !ok {
+		bytes, _ = integrityDigest("sha384", content)
+	}
+	return integrity + "-" + base64.StdEncoding.EncodeToString(bytes)
+}
+
+// integrityContent returns the bytes to digest. JSON objects are encoded
+// with CanonicalJSON when the canonicalization is jcs, and with jsoniter
+// otherwise.
+func integrityContent(value interface{}, canonicalization string) []byte {
 	json := jsoniter.ConfigCompatibleWithStandardLibrary
 	content := make([]byte, 0)
-	bytes := make([]byte, 0)
 	object := iris.Map{}
 	isMap := false
 	switch value.(type) {
@@ -222,28 +388,23 @@ func Integrity(value interface{}, config *toml.Tree) string {
 		}
 	}
 	if isMap {
-		bytes, err := json.Marshal(object)
-		if err != nil {
-			log.Println(err)
+		if canonicalization == "jcs" {
+			bytes, err := CanonicalJSON(object)
+			if err != nil {
+				log.Println(err)
+			} else {
+				content = bytes
+			}
 		} else {
-			content = bytes
+			bytes, err := json.Marshal(object)
+			if err != nil {
+				log.Println(err)
+			} else {
+				content = bytes
+			}
 		}
 	}
-	switch integrity {
-	case "sha256":
-		sum := sha256.Sum256(content)
-		bytes = sum[:]
-	case "sha384":
-		sum := sha512.Sum384(content)
-		bytes = sum[:]
-	case "sha512":
-		sum := sha512.Sum512(content)
-		bytes = sum[:]
-	default:
-		sum := sha512.Sum384(content)
-		bytes = sum[:]
-	}
-	return integrity + "-" + base64.StdEncoding.EncodeToString(bytes)
+	return content
 }
 
 func Signature(signature string, digest string, config *toml.Tree) string {
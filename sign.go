@@ -0,0 +1,549 @@
+package iris_extend_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	ErrSignerType      = errors.New("unknown signer type")
+	ErrSignerAlgorithm = errors.New("unsupported signature algorithm")
+	ErrSignerComponent = errors.New("missing signature component")
+	ErrSignerParameter = errors.New("signature parameter is not a structured field string")
+)
+
+// Signer adds authentication headers to an outgoing request. The body is
+// passed separately because it has already been buffered by the client.
+type Signer interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// LoadSigner builds a Signer from the `type` key of the config, which is
+// one of aws-sigv4, aliyun, hmac or http-message-signature.
+func LoadSigner(config *toml.Tree) (Signer, error) {
+	switch GetString(config, "type") {
+	case "aws-sigv4":
+		return &AWSSigner{
+			AccessKeyId:     GetString(config, "access-key-id"),
+			SecretAccessKey: GetString(config, "secret-access-key"),
+			SessionToken:    GetString(config, "session-token"),
+			Region:          GetString(config, "region", "us-east-1"),
+			Service:         GetString(config, "service", "s3"),
+			UnsignedPayload: GetBool(config, "unsigned-payload"),
+		}, nil
+	case "aliyun":
+		return &AliyunSigner{
+			Product:   GetString(config, "product"),
+			AccessId:  GetString(config, "access-id"),
+			AccessKey: GetString(config, "access-key"),
+			Nonce:     GetBool(config, "nonce"),
+		}, nil
+	case "hmac":
+		return &HMACSigner{
+			KeyId:     GetString(config, "key-id"),
+			Key:       []byte(GetString(config, "key")),
+			Algorithm: GetString(config, "algorithm", "hmac-sha256"),
+			Headers:   GetStringArray(config, "headers"),
+		}, nil
+	case "http-message-signature":
+		signer := &MessageSigner{
+			Label:      GetString(config, "label", "sig1"),
+			KeyId:      GetString(config, "key-id"),
+			Algorithm:  GetString(config, "algorithm", "hmac-sha256"),
+			Components: GetStringArray(config, "components"),
+			Tag:        GetString(config, "tag"),
+			IncludeAlg: GetBool(config, "include-alg"),
+			Nonce:      GetBool(config, "nonce"),
+			Expires:    GetDuration(config, "expires"),
+		}
+		if strings.HasPrefix(signer.Algorithm, "hmac-") {
+			signer.Key = []byte(GetString(config, "key"))
+		} else {
+			signer.Key = SigningKeyDecodeString(GetString(config, "private-key"))
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrSignerType, GetString(config, "type"))
+}
+
+func signerTime(now func() time.Time) time.Time {
+	if now != nil {
+		return now()
+	}
+	return time.Now()
+}
+
+func hmacSum(h func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// AWSSigner implements AWS Signature Version 4 with the Authorization
+// header, as accepted by S3 and S3-compatible stores such as MinIO.
+type AWSSigner struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Service         string
+	UnsignedPayload bool
+	Now             func() time.Time
+}
+
+func (s *AWSSigner) Sign(req *http.Request, body []byte) error {
+	now := signerTime(s.Now).UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payload := "UNSIGNED-PAYLOAD"
+	if !s.UnsignedPayload {
+		sum := sha256.Sum256(body)
+		payload = hex.EncodeToString(sum[:])
+	}
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.Service == "s3" || s.UnsignedPayload {
+		req.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": strings.ToLower(host)}
+	for key, values := range req.Header {
+		name := strings.ToLower(key)
+		switch name {
+		case "authorization", "user-agent", "content-length", "expect":
+			continue
+		}
+		trimmed := make([]string, 0, len(values))
+		for _, value := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(value), " "))
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	segments := strings.Split(path, "/")
+	for index, segment := range segments {
+		segments[index] = awsEscape(segment)
+		if s.Service != "s3" {
+			segments[index] = awsEscape(segments[index])
+		}
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		strings.Join(segments, "/"),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payload,
+	}, "\n")
+	scope := date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	key := hmacSum(sha256.New, []byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSum(sha256.New, key, s.Region)
+	key = hmacSum(sha256.New, key, s.Service)
+	key = hmacSum(sha256.New, key, "aws4_request")
+	signature := hex.EncodeToString(hmacSum(sha256.New, key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKeyId+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+func awsEscape(str string) string {
+	var builder strings.Builder
+	for _, b := range []byte(str) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return builder.String()
+}
+
+func awsCanonicalQuery(values url.Values) string {
+	pairs := make([][2]string, 0, len(values))
+	for key, items := range values {
+		for _, item := range items {
+			pairs = append(pairs, [2]string{awsEscape(key), awsEscape(item)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	query := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		query = append(query, pair[0]+"="+pair[1])
+	}
+	return strings.Join(query, "&")
+}
+
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host = strings.ToLower(host)
+	if strings.HasSuffix(host, ":80") && req.URL.Scheme == "http" {
+		host = strings.TrimSuffix(host, ":80")
+	} else if strings.HasSuffix(host, ":443") && req.URL.Scheme == "https" {
+		host = strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// AliyunSigner signs requests with the same HMAC-SHA1 scheme as
+// AliyunRequestSign. With Nonce set, a random x-<product>-nonce header is
+// added and covered by the signature.
+type AliyunSigner struct {
+	Product   string
+	AccessId  string
+	AccessKey string
+	Nonce     bool
+	Now       func() time.Time
+}
+
+func (s *AliyunSigner) Sign(req *http.Request, body []byte) error {
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Date", signerTime(s.Now).UTC().Format(http.TimeFormat))
+	if s.Nonce {
+		req.Header.Set("X-"+strings.ToLower(s.Product)+"-Nonce", Id())
+	}
+	content := AliyunStringToSign(req.Method, req.Header, s.Product, req.URL.Path)
+	req.Header.Set("Authorization", strings.ToUpper(s.Product)+" "+s.AccessId+":"+AliyunSignature(content, s.AccessKey))
+	return nil
+}
+
+// AliyunStringToSign builds the canonical string used by AliyunRequestSign.
+func AliyunStringToSign(method string, header http.Header, product string, path string) string {
+	content := method + "\n"
+	if values, ok := header["Content-Md5"]; ok && len(values) > 0 {
+		content += values[0] + "\n"
+	}
+	content += header.Get("Content-Type") + "\n" + header.Get("Date") + "\n"
+	prefix := "x-" + strings.ToLower(product) + "-"
+	customHeaders := []string{}
+	for key := range header {
+		name := strings.ToLower(key)
+		if strings.HasPrefix(name, prefix) {
+			customHeaders = append(customHeaders, name)
+		}
+	}
+	sort.Strings(customHeaders)
+	for _, name := range customHeaders {
+		content += name + ":" + header.Get(name) + "\n"
+	}
+	return content + path
+}
+
+func AliyunSignature(content string, accessKey string) string {
+	return base64.StdEncoding.EncodeToString(hmacSum(sha1.New, []byte(accessKey), content))
+}
+
+// HMACSigner signs the method, request target, timestamp, nonce, body
+// digest and any listed headers, and sends the result as
+//
+//	Authorization: HMAC-SHA256 Credential=<key-id>, SignedHeaders=<h1;h2>, Signature=<base64>
+type HMACSigner struct {
+	KeyId     string
+	Key       []byte
+	Algorithm string
+	Headers   []string
+	Now       func() time.Time
+}
+
+func (s *HMACSigner) Sign(req *http.Request, body []byte) error {
+	h, ok := hmacHashes[strings.ToLower(s.Algorithm)]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrSignerAlgorithm, s.Algorithm)
+	}
+	req.Header.Set("X-Timestamp", strconv.FormatInt(signerTime(s.Now).Unix(), 10))
+	req.Header.Set("X-Nonce", Id())
+	content, signedHeaders := HMACStringToSign(req, body, s.Headers)
+	signature := base64.StdEncoding.EncodeToString(hmacSum(h, s.Key, content))
+	req.Header.Set("Authorization", strings.ToUpper(s.Algorithm)+" Credential="+s.KeyId+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+var hmacHashes = map[string]func() hash.Hash{
+	"hmac-sha256": sha256.New,
+	"hmac-sha384": sha512.New384,
+	"hmac-sha512": sha512.New,
+}
+
+// HMACStringToSign returns the canonical string for HMACSigner together
+// with the semicolon separated list of signed headers.
+func HMACStringToSign(req *http.Request, body []byte, headers []string) (string, string) {
+	sum := sha256.Sum256(body)
+	lines := []string{
+		req.Method,
+		req.URL.RequestURI(),
+		req.Header.Get("X-Timestamp"),
+		req.Header.Get("X-Nonce"),
+		hex.EncodeToString(sum[:]),
+	}
+	names := make([]string, 0, len(headers))
+	for _, name := range headers {
+		name = strings.ToLower(strings.TrimSpace(name))
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = requestHost(req)
+		}
+		names = append(names, name)
+		lines = append(lines, name+":"+strings.TrimSpace(value))
+	}
+	return strings.Join(lines, "\n"), strings.Join(names, ";")
+}
+
+// MessageSigner implements HTTP Message Signatures (RFC 9421). Key is a
+// []byte for hmac-sha256 and a crypto.Signer for the asymmetric algorithms.
+type MessageSigner struct {
+	Label      string
+	KeyId      string
+	Algorithm  string
+	Key        interface{}
+	Components []string
+	Tag        string
+	IncludeAlg bool
+	Nonce      bool
+	Expires    time.Duration
+	Now        func() time.Time
+}
+
+func (s *MessageSigner) Sign(req *http.Request, body []byte) error {
+	components := s.Components
+	if len(components) == 0 {
+		components = []string{"@method", "@authority", "@path", "@query"}
+		if len(body) > 0 {
+			components = append(components, "content-type", "content-digest")
+		}
+	}
+	for _, component := range components {
+		if strings.ToLower(component) == "content-digest" && req.Header.Get("Content-Digest") == "" {
+			sum := sha256.Sum256(body)
+			req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		}
+	}
+	created := signerTime(s.Now).Unix()
+	params := ";created=" + strconv.FormatInt(created, 10)
+	if s.Expires > 0 {
+		params += ";expires=" + strconv.FormatInt(created+int64(s.Expires/time.Second), 10)
+	}
+	strs := make([][2]string, 0, 4)
+	if s.Nonce {
+		strs = append(strs, [2]string{"nonce", NormalizeId(Id())})
+	}
+	strs = append(strs, [2]string{"keyid", s.KeyId})
+	if s.IncludeAlg {
+		strs = append(strs, [2]string{"alg", s.Algorithm})
+	}
+	if s.Tag != "" {
+		strs = append(strs, [2]string{"tag", s.Tag})
+	}
+	for _, param := range strs {
+		value, err := structuredString(param[1])
+		if err != nil {
+			return err
+		}
+		params += ";" + param[0] + "=" + value
+	}
+	base, input, err := MessageSignatureBase(req, components, params)
+	if err != nil {
+		return err
+	}
+	signature, err := messageSign(s.Algorithm, s.Key, []byte(base))
+	if err != nil {
+		return err
+	}
+	label := s.Label
+	if label == "" {
+		label = "sig1"
+	}
+	req.Header.Set("Signature-Input", label+"="+input)
+	req.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+	return nil
+}
+
+// MessageSignatureBase returns the signature base of RFC 9421 section 2.5
+// and the signature parameters value to send in Signature-Input.
+func MessageSignatureBase(req *http.Request, components []string, params string) (string, string, error) {
+	var builder strings.Builder
+	identifiers := make([]string, 0, len(components))
+	for _, component := range components {
+		name := strings.ToLower(strings.TrimSpace(component))
+		value, err := messageComponent(req, name)
+		if err != nil {
+			return "", "", err
+		}
+		identifier, err := structuredString(name)
+		if err != nil {
+			return "", "", err
+		}
+		builder.WriteString(identifier + ": " + value + "\n")
+		identifiers = append(identifiers, identifier)
+	}
+	input := "(" + strings.Join(identifiers, " ") + ")" + params
+	builder.WriteString(`"@signature-params": ` + input)
+	return builder.String(), input, nil
+}
+
+// structuredString quotes str as an sf-string of RFC 8941 section 3.3.3,
+// which only allows printable ASCII and escapes just `"` and `\`.
+func structuredString(str string) (string, error) {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for index := 0; index < len(str); index++ {
+		b := str[index]
+		if b < 0x20 || b > 0x7e {
+			return "", fmt.Errorf("%w: %q", ErrSignerParameter, str)
+		}
+		if b == '"' || b == '\\' {
+			builder.WriteByte('\\')
+		}
+		builder.WriteByte(b)
+	}
+	builder.WriteByte('"')
+	return builder.String(), nil
+}
+
+func messageComponent(req *http.Request, name string) (string, error) {
+	switch name {
+	case "@method":
+		return strings.ToUpper(req.Method), nil
+	case "@target-uri":
+		u := *req.URL
+		u.Host = requestHost(req)
+		return u.String(), nil
+	case "@authority":
+		return requestHost(req), nil
+	case "@scheme":
+		return strings.ToLower(req.URL.Scheme), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if path := req.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+	if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("%w %s", ErrSignerComponent, name)
+	}
+	values := req.Header.Values(name)
+	if name == "host" && len(values) == 0 {
+		values = []string{requestHost(req)}
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("%w %s", ErrSignerComponent, name)
+	}
+	for index, value := range values {
+		values[index] = strings.TrimSpace(value)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+func messageSign(algorithm string, key interface{}, base []byte) ([]byte, error) {
+	switch algorithm {
+	case "hmac-sha256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("%w %s: key must be []byte", ErrSignerAlgorithm, algorithm)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	case "ed25519":
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w %s: key must be ed25519.PrivateKey", ErrSignerAlgorithm, algorithm)
+		}
+		return ed25519.Sign(privateKey, base), nil
+	case "rsa-pss-sha512":
+		privateKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w %s: key must be *rsa.PrivateKey", ErrSignerAlgorithm, algorithm)
+		}
+		sum := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, privateKey, crypto.SHA512, sum[:], &rsa.PSSOptions{SaltLength: 64})
+	case "rsa-v1_5-sha256":
+		privateKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w %s: key must be *rsa.PrivateKey", ErrSignerAlgorithm, algorithm)
+		}
+		sum := sha256.Sum256(base)
+		return rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, sum[:])
+	case "ecdsa-p256-sha256", "ecdsa-p384-sha384":
+		privateKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w %s: key must be *ecdsa.PrivateKey", ErrSignerAlgorithm, algorithm)
+		}
+		var digest []byte
+		size := 32
+		if algorithm == "ecdsa-p384-sha384" {
+			sum := sha512.Sum384(base)
+			digest, size = sum[:], 48
+		} else {
+			sum := sha256.Sum256(base)
+			digest = sum[:]
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest)
+		if err != nil {
+			return nil, err
+		}
+		return append(fixedBytes(r, size), fixedBytes(s, size)...), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrSignerAlgorithm, algorithm)
+}
+
+func fixedBytes(n *big.Int, size int) []byte {
+	bytes := make([]byte, size)
+	return n.FillBytes(bytes)
+}
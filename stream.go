@@ -0,0 +1,331 @@
+package iris_extend_helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+var (
+	ErrBodyTooLarge = errors.New("response body too large")
+	ErrResumeFailed = errors.New("download cannot be resumed")
+)
+
+// ProgressFunc receives the number of bytes read so far and the expected
+// total, which is -1 when the server does not announce a length.
+type ProgressFunc func(written int64, total int64)
+
+type StreamResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+type streamBody struct {
+	io.Reader
+	closer io.Closer
+	cancel context.CancelFunc
+}
+
+func (b *streamBody) Close() error {
+	err := b.closer.Close()
+	b.cancel()
+	return err
+}
+
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+type progressReader struct {
+	reader   io.Reader
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	if n > 0 {
+		p.written += int64(n)
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
+
+func newLimitedReader(reader io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return reader
+	}
+	return &limitedReader{reader: reader, remaining: max}
+}
+
+func newProgressReader(reader io.Reader, written int64, total int64, progress ProgressFunc) io.Reader {
+	if progress == nil {
+		return reader
+	}
+	if total < 0 {
+		total = -1
+	}
+	return &progressReader{reader: reader, written: written, total: total, progress: progress}
+}
+
+func limitBody(res *http.Response, max int64) io.Reader {
+	if max > 0 && res.ContentLength > max {
+		return &limitedReader{reader: res.Body, remaining: -1}
+	}
+	return newLimitedReader(res.Body, max)
+}
+
+// Stream sends the request and returns the response without reading its
+// body. The caller must close the body, which also releases the timeout.
+func (c *Client) Stream(ctx context.Context, request Request) (*StreamResponse, error) {
+	req, cancel, err := c.newHTTPRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, &RequestError{Kind: ErrTransport, Method: req.Method, URL: request.URL, Err: err}
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		content, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+		res.Body.Close()
+		cancel()
+		return nil, &RequestError{
+			Kind:       ErrStatus,
+			Method:     req.Method,
+			URL:        request.URL,
+			StatusCode: res.StatusCode,
+			Body:       content,
+		}
+	}
+	if request.MaxBodySize > 0 && res.ContentLength > request.MaxBodySize {
+		res.Body.Close()
+		cancel()
+		return nil, &RequestError{
+			Kind:       ErrBodyTooLarge,
+			Method:     req.Method,
+			URL:        request.URL,
+			StatusCode: res.StatusCode,
+			Err:        fmt.Errorf("content length %d exceeds %d", res.ContentLength, request.MaxBodySize),
+		}
+	}
+	reader := newProgressReader(limitBody(res, request.MaxBodySize), 0, res.ContentLength, request.Progress)
+	return &StreamResponse{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       &streamBody{Reader: reader, closer: res.Body, cancel: cancel},
+	}, nil
+}
+
+// Download copies the response body to w. Interrupted transfers are retried
+// up to retries times with a Range request starting at the last byte written.
+// A retry fails with ErrResumeFailed when the server sends the whole body
+// and it cannot be shown to be unchanged by its ETag or Last-Modified.
+func (c *Client) Download(ctx context.Context, request Request, w io.Writer, retries int) (int64, error) {
+	return c.download(ctx, request, w, 0, retries, nil)
+}
+
+// DownloadFile appends the response body to the file at path, resuming
+// from the current file size if an earlier download was interrupted. Pass
+// the ETag or Last-Modified of the earlier response as If-Range in the
+// request header to resume it; otherwise, or when the file has changed,
+// the server sends the whole body and the file is truncated first.
+func (c *Client) DownloadFile(ctx context.Context, request Request, path string, retries int) (int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return c.download(ctx, request, file, info.Size(), retries, func() error {
+		return file.Truncate(0)
+	})
+}
+
+// download resumes at offset. When a resumed request is answered with the
+// whole body of a resource that may have changed, reset is called to
+// discard what was written, or the download fails if reset is nil.
+func (c *Client) download(ctx context.Context, request Request, w io.Writer, offset int64, retries int, reset func() error) (int64, error) {
+	written := offset
+	validator := request.Header.Get("If-Range")
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return written, ctx.Err()
+			case <-time.After(BackoffDelay("exponential", time.Second, attempt)):
+			}
+		}
+		req := request
+		req.MaxBodySize = 0
+		req.Progress = nil
+		req.Header = http.Header{}
+		if request.Header != nil {
+			req.Header = request.Header.Clone()
+		}
+		if written > 0 {
+			req.Header.Set("Range", "bytes="+strconv.FormatInt(written, 10)+"-")
+			if validator != "" {
+				req.Header.Set("If-Range", validator)
+			}
+		}
+		stream, err := c.Stream(ctx, req)
+		if err != nil {
+			var requestError *RequestError
+			if errors.As(err, &requestError) && requestError.Kind == ErrStatus {
+				code := requestError.StatusCode
+				if code == http.StatusRequestedRangeNotSatisfiable && written > 0 {
+					return written, nil
+				}
+				if code < 500 && code != http.StatusTooManyRequests {
+					return written, err
+				}
+			}
+			lastErr = err
+			continue
+		}
+		skip := int64(0)
+		total := stream.Header.Get("Content-Length")
+		size := int64(-1)
+		if stream.StatusCode == http.StatusPartialContent {
+			start, length, ok := parseContentRange(stream.Header.Get("Content-Range"))
+			if !ok || start != written {
+				stream.Body.Close()
+				return written, ErrResumeFailed
+			}
+			size = length
+		} else {
+			if written > 0 && (validator == "" || responseValidator(stream.Header) != validator) {
+				if reset == nil {
+					stream.Body.Close()
+					return written, ErrResumeFailed
+				}
+				if err := reset(); err != nil {
+					stream.Body.Close()
+					return written, err
+				}
+				written = 0
+				validator = ""
+			}
+			skip = written
+			if total != "" {
+				size, _ = strconv.ParseInt(total, 10, 64)
+			}
+		}
+		if validator == "" {
+			validator = responseValidator(stream.Header)
+		}
+		if skip > 0 {
+			if _, err := io.CopyN(ioutil.Discard, stream.Body, skip); err != nil {
+				stream.Body.Close()
+				lastErr = err
+				continue
+			}
+		}
+		reader := io.Reader(stream.Body)
+		if request.MaxBodySize > 0 {
+			if size > request.MaxBodySize {
+				stream.Body.Close()
+				return written, ErrBodyTooLarge
+			}
+			// Not newLimitedReader, which would not limit a resumed
+			// download that has already reached MaxBodySize.
+			reader = &limitedReader{reader: reader, remaining: request.MaxBodySize - written}
+		}
+		reader = newProgressReader(reader, written, size, request.Progress)
+		n, err := io.Copy(w, reader)
+		stream.Body.Close()
+		written += n
+		if err == nil {
+			return written, nil
+		}
+		if errors.Is(err, ErrBodyTooLarge) {
+			return written, err
+		}
+		lastErr = err
+	}
+	return written, lastErr
+}
+
+// parseContentRange returns the first byte and the complete length from
+// a Content-Range header such as "bytes 200-999/1000".
+func parseContentRange(value string) (int64, int64, bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	length := int64(-1)
+	if parts[1] != "*" {
+		if length, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, length, true
+}
+
+func responseValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+func StreamData(request iris.Map) (io.ReadCloser, bool) {
+	stream, err := defaultClient.Stream(context.Background(), NewRequest(http.MethodGet, request))
+	if err != nil {
+		log.Println(err)
+		return nil, false
+	}
+	return stream.Body, true
+}
+
+func DownloadData(request iris.Map, path string, retries int) (int64, bool) {
+	written, err := defaultClient.DownloadFile(context.Background(), NewRequest(http.MethodGet, request), path, retries)
+	if err != nil {
+		log.Println(err)
+		return written, false
+	}
+	return written, true
+}
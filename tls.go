@@ -0,0 +1,64 @@
+package iris_extend_helper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/pelletier/go-toml"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func NewTLSConfig(config *toml.Tree) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: GetString(config, "server-name"),
+	}
+	if version := GetString(config, "min-version"); version != "" {
+		value, ok := tlsVersions[version]
+		if !ok {
+			return nil, fmt.Errorf("tls: unsupported min-version %q", version)
+		}
+		tlsConfig.MinVersion = value
+	}
+	if path := GetString(config, "ca-file"); path != "" {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || GetBool(config, "ca-only") {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", path)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	certFile := GetString(config, "cert-file")
+	keyFile := GetString(config, "key-file")
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("tls: cert-file and key-file must be set together")
+		}
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	if GetBool(config, "insecure-skip-verify") {
+		log.Println("tls: certificate verification is disabled by insecure-skip-verify")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,155 @@
+package iris_extend_helper
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/pelletier/go-toml"
+)
+
+const DefaultAccessIdKey = "access-id"
+
+var (
+	ErrSignatureMissing  = errors.New("signature is missing")
+	ErrSignatureInvalid  = errors.New("signature is invalid")
+	ErrSignatureExpired  = errors.New("request date is outside the allowed clock skew")
+	ErrNonceMissing      = errors.New("nonce is missing")
+	ErrNonceReplayed     = errors.New("nonce has already been used")
+	ErrCredentialUnknown = errors.New("unknown access id")
+	ErrContentMD5        = errors.New("content md5 does not match body")
+)
+
+type CredentialProvider interface {
+	LookupAccessKey(accessId string) (string, error)
+}
+
+type CredentialFunc func(accessId string) (string, error)
+
+func (f CredentialFunc) LookupAccessKey(accessId string) (string, error) {
+	return f(accessId)
+}
+
+type StaticCredentials map[string]string
+
+func (c StaticCredentials) LookupAccessKey(accessId string) (string, error) {
+	if accessKey, ok := c[accessId]; ok {
+		return accessKey, nil
+	}
+	return "", ErrCredentialUnknown
+}
+
+// LoadCredentials reads access id and access key pairs from the keys of
+// the config table.
+func LoadCredentials(config *toml.Tree) StaticCredentials {
+	credentials := make(StaticCredentials)
+	for _, accessId := range config.Keys() {
+		credentials[accessId] = GetString(config, accessId)
+	}
+	return credentials
+}
+
+// SignatureVerification verifies requests signed with AliyunRequestSign or
+// AliyunSigner. Nonces sent in the x-<product>-nonce header are recorded in
+// the store and rejected when seen again within the clock skew window.
+//
+// A nonce is required by default, since without one a captured request can
+// be replayed until its date leaves the clock skew window. Clients send one
+// with `aliyun_nonce` in AliyunRequestSign or Nonce in AliyunSigner; servers
+// whose clients cannot opt out with `require-nonce = false`.
+func SignatureVerification(config *toml.Tree, credentials CredentialProvider, store RevocationStore) iris.Handler {
+	product := GetString(config, "product")
+	scheme := strings.ToUpper(product) + " "
+	nonceHeader := "X-" + strings.ToLower(product) + "-Nonce"
+	skew := GetDuration(config, "max-clock-skew", 15*time.Minute)
+	requireNonce := GetBool(config, "require-nonce", true)
+	contextKey := GetString(config, "context-key", DefaultAccessIdKey)
+	if store == nil {
+		store = NewMemoryRevocationStore()
+	}
+	return func(ctx iris.Context) {
+		req := ctx.Request()
+		authorization := req.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, scheme) {
+			respondSignatureError(ctx, scheme, ErrSignatureMissing)
+			return
+		}
+		parts := strings.SplitN(strings.TrimPrefix(authorization, scheme), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			respondSignatureError(ctx, scheme, ErrSignatureMissing)
+			return
+		}
+		accessId, signature := parts[0], parts[1]
+		date, err := http.ParseTime(req.Header.Get("Date"))
+		if err != nil {
+			respondSignatureError(ctx, scheme, ErrSignatureExpired)
+			return
+		}
+		if offset := time.Since(date); offset > skew || offset < -skew {
+			respondSignatureError(ctx, scheme, ErrSignatureExpired)
+			return
+		}
+		accessKey, err := credentials.LookupAccessKey(accessId)
+		if err != nil {
+			log.Println(err)
+			respondSignatureError(ctx, scheme, ErrSignatureInvalid)
+			return
+		}
+		content := AliyunStringToSign(req.Method, req.Header, product, req.URL.Path)
+		expected := AliyunSignature(content, accessKey)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			respondSignatureError(ctx, scheme, ErrSignatureInvalid)
+			return
+		}
+		if values, ok := req.Header["Content-Md5"]; ok && len(values) > 0 {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				respondSignatureError(ctx, scheme, err)
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			sum := md5.Sum(body)
+			if base64.StdEncoding.EncodeToString(sum[:]) != values[0] {
+				respondSignatureError(ctx, scheme, ErrContentMD5)
+				return
+			}
+		}
+		if nonce := req.Header.Get(nonceHeader); nonce != "" {
+			ok, err := store.UseOnce(accessId+":"+nonce, date.Add(skew))
+			if err != nil {
+				respondSignatureError(ctx, scheme, err)
+				return
+			}
+			if !ok {
+				respondSignatureError(ctx, scheme, ErrNonceReplayed)
+				return
+			}
+		} else if requireNonce {
+			respondSignatureError(ctx, scheme, ErrNonceMissing)
+			return
+		}
+		ctx.Values().Set(contextKey, accessId)
+		ctx.Next()
+	}
+}
+
+func respondSignatureError(ctx iris.Context, scheme string, err error) {
+	log.Println(err)
+	ctx.Header("WWW-Authenticate", scheme+`error="invalid_signature"`)
+	ctx.StatusCode(iris.StatusUnauthorized)
+	ctx.JSON(iris.Map{
+		"success": false,
+		"code":    iris.StatusUnauthorized,
+		"error":   "invalid_signature",
+		"message": err.Error(),
+	})
+	ctx.StopExecution()
+}